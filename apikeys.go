@@ -0,0 +1,292 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// APIKey is an API key stored in the system database. Only the SHA-256 hash of
+// the secret is stored; the secret itself is returned once, on creation or rotation.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"size:255;not null"`
+	Owner      string     `json:"owner" gorm:"size:255"`
+	Prefix     string     `json:"prefix" gorm:"size:16"` // Start of the secret, to recognize a key without revealing it
+	KeyHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex:idx_api_keys_key_hash"`
+	Scopes     StringList `json:"scopes" gorm:"type:text"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked" gorm:"not null;default:false"`
+
+	RateLimit    int64 `json:"rate_limit"`    // Requests per minute, 0 for the default
+	DailyQuota   int64 `json:"daily_quota"`   // Requests per UTC day, 0 for no quota
+	MonthlyQuota int64 `json:"monthly_quota"` // Requests per UTC month, 0 for no quota
+
+	limiterKey string // Overrides limiterIdentity for keys without a row, e.g. the anonymous key
+}
+
+// Secrets look like "bcal_" followed by 64 hex characters
+const (
+	apiKeySecretPrefix = "bcal_"
+	apiKeyPrefixLength = len(apiKeySecretPrefix) + 8
+)
+
+// How long authenticated keys are cached, and how often last_used_at is written.
+// Revocations through the API take effect immediately on this instance and
+// within apiKeyCacheTTL on others sharing the system database.
+const (
+	apiKeyCacheTTL       = 1 * time.Minute
+	apiKeyLastUsedPeriod = 1 * time.Minute
+)
+
+// hashAPIKey returns the hex SHA-256 of a secret. Secrets are random 256-bit
+// values, so a fast unsalted hash is enough and keeps lookups indexed.
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateAPIKeySecret returns a new random secret
+func generateAPIKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return apiKeySecretPrefix + hex.EncodeToString(b), nil
+}
+
+type cachedAPIKey struct {
+	key     *APIKey
+	expires time.Time
+}
+
+// apiKeyCache caches authenticated keys by secret hash
+var apiKeyCache = struct {
+	sync.Mutex
+	entries map[string]cachedAPIKey
+}{entries: map[string]cachedAPIKey{}}
+
+// forgetAPIKey drops a key from the cache after it was revoked or rotated
+func forgetAPIKey(keyHash string) {
+	apiKeyCache.Lock()
+	delete(apiKeyCache.entries, keyHash)
+	apiKeyCache.Unlock()
+}
+
+// isCachedAPIKey reports whether secret belongs to an active key cached by
+// lookupAPIKey, so it can be recognized without querying the database
+func isCachedAPIKey(secret string) bool {
+	apiKeyCache.Lock()
+	entry, ok := apiKeyCache.entries[hashAPIKey(secret)]
+	apiKeyCache.Unlock()
+
+	now := time.Now()
+	return ok && now.Before(entry.expires) && !entry.key.Revoked && (entry.key.ExpiresAt == nil || now.Before(*entry.key.ExpiresAt))
+}
+
+// lookupAPIKey returns the active key matching secret, or nil when there is no
+// such key or it is revoked or expired. Found keys are cached for apiKeyCacheTTL,
+// and their last_used_at is refreshed at most once per apiKeyLastUsedPeriod.
+func lookupAPIKey(db *gorm.DB, secret string) (*APIKey, error) {
+	keyHash := hashAPIKey(secret)
+	now := time.Now()
+
+	apiKeyCache.Lock()
+	entry, ok := apiKeyCache.entries[keyHash]
+	apiKeyCache.Unlock()
+
+	if !ok || now.After(entry.expires) {
+		var key APIKey
+		err := db.Where("key_hash = ?", keyHash).First(&key).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			forgetAPIKey(keyHash)
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry = cachedAPIKey{key: &key, expires: now.Add(apiKeyCacheTTL)}
+		apiKeyCache.Lock()
+		apiKeyCache.entries[keyHash] = entry
+		apiKeyCache.Unlock()
+	}
+
+	key := entry.key
+	if key.Revoked || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, nil
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyLastUsedPeriod {
+		// The cached key is shared between requests, so it is replaced rather than modified
+		used := *key
+		used.LastUsedAt = &now
+		if err := db.Model(&APIKey{}).Where("id = ?", key.ID).Update("last_used_at", now).Error; err != nil {
+			zlog.Warn().Uint("api_key_id", key.ID).Err(err).Msg("lookupAPIKey: Failed to update last_used_at")
+		}
+		apiKeyCache.Lock()
+		apiKeyCache.entries[keyHash] = cachedAPIKey{key: &used, expires: entry.expires}
+		apiKeyCache.Unlock()
+		key = &used
+	}
+	return key, nil
+}
+
+// APIKeyRequest is the body of POST /api/admin/keys
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Owner     string     `json:"owner"`
+	Scopes    []string   `json:"scopes"`     // Defaults to events:read
+	ExpiresAt *time.Time `json:"expires_at"` // Optional, RFC 3339
+
+	APIKeyLimitsRequest
+}
+
+// validate normalizes the request and checks its fields
+func (r *APIKeyRequest) validate() error {
+	r.Name, r.Owner = strings.TrimSpace(r.Name), strings.TrimSpace(r.Owner)
+	if r.Name == "" {
+		return errors.New("'name' is required")
+	}
+	if len(r.Scopes) == 0 {
+		r.Scopes = []string{scopeEventsRead}
+	}
+	for _, scope := range r.Scopes {
+		if !slices.Contains(knownScopes, scope) {
+			return fmt.Errorf("unknown scope '%s', expected one of %s", scope, strings.Join(knownScopes, ", "))
+		}
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("'expires_at' must be in the future")
+	}
+	return r.APIKeyLimitsRequest.validate()
+}
+
+// Handler for POST /api/admin/keys
+// Creates an API key. The secret is only returned in this response.
+func createAPIKeyHandler(c *fiber.Ctx) error {
+	var req APIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		zlog.Warn().Err(err).Msg("createAPIKeyHandler: Cannot parse JSON")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	secret, err := generateAPIKeySecret()
+	if err != nil {
+		zlog.Error().Err(err).Msg("createAPIKeyHandler: Failed to generate secret")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+	key := APIKey{
+		Name:      req.Name,
+		Owner:     req.Owner,
+		Prefix:    secret[:apiKeyPrefixLength],
+		KeyHash:   hashAPIKey(secret),
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+
+		RateLimit:    req.RateLimit,
+		DailyQuota:   req.DailyQuota,
+		MonthlyQuota: req.MonthlyQuota,
+	}
+	if err := systemDB.Create(&key).Error; err != nil {
+		zlog.Error().Err(err).Msg("createAPIKeyHandler: Failed to store API key")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create API key"})
+	}
+
+	zlog.Info().Uint("api_key_id", key.ID).Str("name", key.Name).Strs("scopes", key.Scopes).Msg("createAPIKeyHandler: API key created")
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": key, "secret": secret})
+}
+
+// Handler for GET /api/admin/keys
+// Lists API keys without their secrets. Revoked keys are included.
+func listAPIKeysHandler(c *fiber.Ctx) error {
+	var keys []APIKey
+	if err := systemDB.Order("id asc").Find(&keys).Error; err != nil {
+		zlog.Error().Err(err).Msg("listAPIKeysHandler: Failed to retrieve API keys")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve API keys"})
+	}
+	return c.JSON(fiber.Map{"data": keys})
+}
+
+// findAPIKey loads the key named by the :id route parameter. When it returns a
+// nil key, the error response has been written and err is the result of writing it.
+func findAPIKey(c *fiber.Ctx, handler string) (*APIKey, error) {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid API key ID format"})
+	}
+	var key APIKey
+	if err := systemDB.First(&key, uint(id)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "API key not found"})
+		}
+		zlog.Error().Uint64("api_key_id", id).Err(err).Msg(handler + ": Failed to retrieve API key")
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve API key"})
+	}
+	return &key, nil
+}
+
+// Handler for POST /api/admin/keys/{id}/rotate
+// Replaces the secret of a key, keeping its name, scopes and expiry. The old
+// secret stops working immediately.
+func rotateAPIKeyHandler(c *fiber.Ctx) error {
+	key, err := findAPIKey(c, "rotateAPIKeyHandler")
+	if key == nil {
+		return err
+	}
+	if key.Revoked {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "API key is revoked"})
+	}
+
+	secret, err := generateAPIKeySecret()
+	if err != nil {
+		zlog.Error().Err(err).Msg("rotateAPIKeyHandler: Failed to generate secret")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rotate API key"})
+	}
+	oldHash := key.KeyHash
+	key.Prefix, key.KeyHash = secret[:apiKeyPrefixLength], hashAPIKey(secret)
+	if err := systemDB.Model(key).Updates(map[string]interface{}{
+		"prefix":   key.Prefix,
+		"key_hash": key.KeyHash,
+	}).Error; err != nil {
+		zlog.Error().Uint("api_key_id", key.ID).Err(err).Msg("rotateAPIKeyHandler: Failed to store API key")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to rotate API key"})
+	}
+	forgetAPIKey(oldHash)
+
+	zlog.Info().Uint("api_key_id", key.ID).Msg("rotateAPIKeyHandler: API key rotated")
+	return c.JSON(fiber.Map{"data": key, "secret": secret})
+}
+
+// Handler for POST /api/admin/keys/{id}/revoke
+// Revokes a key. The row is kept so the key still shows up in listings.
+func revokeAPIKeyHandler(c *fiber.Ctx) error {
+	key, err := findAPIKey(c, "revokeAPIKeyHandler")
+	if key == nil {
+		return err
+	}
+	key.Revoked = true
+	if err := systemDB.Model(key).Update("revoked", true).Error; err != nil {
+		zlog.Error().Uint("api_key_id", key.ID).Err(err).Msg("revokeAPIKeyHandler: Failed to revoke API key")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to revoke API key"})
+	}
+	forgetAPIKey(key.KeyHash)
+
+	zlog.Info().Uint("api_key_id", key.ID).Msg("revokeAPIKeyHandler: API key revoked")
+	return c.JSON(fiber.Map{"data": key})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStoredAPIKeyLifecycle(t *testing.T) {
+	db, err := InitSystemDB(filepath.Join(t.TempDir(), "system.db"))
+	if err != nil {
+		t.Fatalf("InitSystemDB failed: %v", err)
+	}
+	systemDB = db
+	validAPIKeys, _ = parseAPIKeys("bootstrap=admin")
+	defer func() { systemDB, validAPIKeys = nil, nil }()
+
+	app := fiber.New()
+	api := app.Group("/api", authMiddleware)
+	api.Get("/events", requireScope(scopeEventsRead), func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+	admin := api.Group("/admin", requireScope(scopeAdmin))
+	admin.Post("/keys", createAPIKeyHandler)
+	admin.Get("/keys", listAPIKeysHandler)
+	admin.Post("/keys/:id/rotate", rotateAPIKeyHandler)
+	admin.Post("/keys/:id/revoke", revokeAPIKeyHandler)
+
+	do := func(method, path, key, body string) (*http.Response, map[string]json.RawMessage) {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-KEY", key)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		var decoded map[string]json.RawMessage
+		json.NewDecoder(res.Body).Decode(&decoded)
+		return res, decoded
+	}
+	secretOf := func(body map[string]json.RawMessage) string {
+		var secret string
+		if err := json.Unmarshal(body["secret"], &secret); err != nil || secret == "" {
+			t.Fatalf("expected a secret in the response, got %s", body["secret"])
+		}
+		return secret
+	}
+
+	// 1. Create a read-only key; only its hash is stored
+	res, body := do(http.MethodPost, "/api/admin/keys", "bootstrap", `{"name": "widget", "owner": "site", "scopes": ["events:read"]}`)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	secret := secretOf(body)
+	var stored APIKey
+	if err := db.First(&stored).Error; err != nil {
+		t.Fatalf("failed to load stored key: %v", err)
+	}
+	if stored.KeyHash == secret || stored.KeyHash != hashAPIKey(secret) {
+		t.Fatalf("expected the secret to be stored hashed")
+	}
+
+	if res, _ := do(http.MethodGet, "/api/events", secret, ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the new key to read events, got %d", res.StatusCode)
+	}
+	if res, _ := do(http.MethodGet, "/api/admin/keys", secret, ""); res.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected the read-only key to be refused admin access, got %d", res.StatusCode)
+	}
+	if err := db.First(&stored, stored.ID).Error; err != nil || stored.LastUsedAt == nil {
+		t.Fatalf("expected last_used_at to be set, got %v (%v)", stored.LastUsedAt, err)
+	}
+
+	// 2. Rotating replaces the secret immediately
+	res, body = do(http.MethodPost, "/api/admin/keys/1/rotate", "bootstrap", "")
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on rotate, got %d", res.StatusCode)
+	}
+	rotated := secretOf(body)
+	if res, _ := do(http.MethodGet, "/api/events", secret, ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the old secret to be rejected, got %d", res.StatusCode)
+	}
+	if res, _ := do(http.MethodGet, "/api/events", rotated, ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected the rotated secret to work, got %d", res.StatusCode)
+	}
+
+	// 3. Revoking takes effect despite the cache
+	if res, _ := do(http.MethodPost, "/api/admin/keys/1/revoke", "bootstrap", ""); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK on revoke, got %d", res.StatusCode)
+	}
+	if res, _ := do(http.MethodGet, "/api/events", rotated, ""); res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected the revoked key to be rejected, got %d", res.StatusCode)
+	}
+
+	// 4. Expiry must be in the future
+	if res, _ := do(http.MethodPost, "/api/admin/keys", "bootstrap", `{"name": "old", "expires_at": "2001-01-01T00:00:00Z"}`); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a past expiry, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Actions recorded in the audit log
+const (
+	auditCreate    = "create"
+	auditUpdate    = "update"
+	auditDelete    = "delete"
+	auditRestore   = "restore"  // An earlier revision written back to the event
+	auditUndelete  = "undelete" // Taken out of the trash
+	auditPurge     = "purge"    // Permanently deleted from the trash
+	auditMerge     = "merge"    // A duplicate merged into the event
+	auditTagRename = "tag_rename"
+	auditTagMerge  = "tag_merge"
+	auditTagDelete = "tag_delete"
+)
+
+// Event fields left out of audit diffs; the audit entry has its own timestamp
+var auditIgnoredFields = []string{"created_at", "updated_at", "fallback"}
+
+// FieldChange is the value of an event field before and after a mutation.
+// Before is null for created events, After is null for deleted ones.
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditDiff maps the changed fields of an event, by JSON name, to their change.
+// It is stored as a JSON object.
+type AuditDiff map[string]FieldChange
+
+// Value stores the diff as a JSON object string
+func (d AuditDiff) Value() (driver.Value, error) {
+	if d == nil {
+		return "{}", nil
+	}
+	b, err := json.Marshal(map[string]FieldChange(d))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads a diff stored as a JSON object string
+func (d *AuditDiff) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*d = AuditDiff{}
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into AuditDiff", src)
+	}
+	return json.Unmarshal(raw, (*map[string]FieldChange)(d))
+}
+
+// AuditEntry is a row of the audit_log table, stored in the system database.
+// Every mutation of an event through the API is recorded with the key that made it.
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	KeyID     *uint     `json:"key_id" gorm:"index:idx_audit_log_key_id"` // Null for keys from API_KEYS
+	KeyName   string    `json:"key_name" gorm:"size:255"`
+	Action    string    `json:"action" gorm:"size:32;not null"`
+	EventID   uint      `json:"event_id" gorm:"not null;index:idx_audit_log_event,priority:2"`
+	Lang      string    `json:"lang" gorm:"size:16;not null;index:idx_audit_log_event,priority:1"`
+	Diff      AuditDiff `json:"diff" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_audit_log_created_at"`
+}
+
+// TableName keeps the table name singular, as it is a log
+func (AuditEntry) TableName() string {
+	return "audit_log"
+}
+
+// eventFields returns the JSON fields of an event, or nil for a nil event
+func eventFields(event *Event) (map[string]interface{}, error) {
+	if event == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(b, &fields)
+	return fields, err
+}
+
+// diffEvents returns the fields that differ between two versions of an event.
+// A nil before or after stands for an event that did not exist.
+func diffEvents(before, after *Event) (AuditDiff, error) {
+	beforeFields, err := eventFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := eventFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := AuditDiff{}
+	for _, fields := range []map[string]interface{}{beforeFields, afterFields} {
+		for name := range fields {
+			if _, done := diff[name]; done || slices.Contains(auditIgnoredFields, name) {
+				continue
+			}
+			b, a := beforeFields[name], afterFields[name]
+			if !reflect.DeepEqual(b, a) {
+				diff[name] = FieldChange{Before: b, After: a}
+			}
+		}
+	}
+	return diff, nil
+}
+
+// newAuditEntry describes a mutation of an event made by the request's API key.
+// before is nil for creations and after is nil for deletions.
+func newAuditEntry(c *fiber.Ctx, action, lang string, before, after *Event) AuditEntry {
+	// Timestamps are stored in UTC so time range filters compare consistently
+	entry := AuditEntry{Action: action, Lang: lang, CreatedAt: time.Now().UTC()}
+	if key := requestAPIKey(c); key != nil {
+		entry.KeyName = key.Name
+		if key.ID != 0 {
+			id := key.ID
+			entry.KeyID = &id
+		}
+	}
+	if after != nil {
+		entry.EventID = after.ID
+	} else if before != nil {
+		entry.EventID = before.ID
+	}
+
+	diff, err := diffEvents(before, after)
+	if err != nil {
+		zlog.Error().Uint("event_id", entry.EventID).Str("lang", lang).Err(err).Msg("newAuditEntry: Failed to diff event")
+	}
+	entry.Diff = diff
+	return entry
+}
+
+// writeAudit stores audit entries once their mutation is committed. The event
+// databases and the system database are separate files, so a failure here
+// cannot undo the mutation; it is logged instead.
+func writeAudit(entries ...AuditEntry) {
+	if systemDB == nil || len(entries) == 0 {
+		return
+	}
+	if err := systemDB.CreateInBatches(entries, 100).Error; err != nil {
+		for _, entry := range entries {
+			zlog.Error().Str("action", entry.Action).Uint("event_id", entry.EventID).Str("lang", entry.Lang).Str("key_name", entry.KeyName).Err(err).Msg("writeAudit: Failed to record audit entry")
+		}
+	}
+}
+
+// parseAuditTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(fullDateLayout, value)
+}
+
+// Handler for GET /api/admin/audit
+// Lists audit entries, newest first, filtered by event, key, action or time range.
+func getAuditLogHandler(c *fiber.Ctx) error {
+	page, limit, offset := parsePagination(c)
+	query := systemDB.Model(&AuditEntry{})
+
+	// Entries of all languages are listed unless lang is given. Event IDs are
+	// only unique within a language, so event_id also filters by language.
+	if v := c.Query("event_id"); v != "" {
+		eventID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid event_id"})
+		}
+		query = query.Where("event_id = ?", eventID)
+	}
+	if c.Query("lang") != "" || c.Query("event_id") != "" {
+		lang, _ := requestLanguage(c)
+		query = query.Where("lang = ?", lang)
+	}
+	if v := c.Query("key_id"); v != "" {
+		keyID, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid key_id"})
+		}
+		query = query.Where("key_id = ?", keyID)
+	}
+	if v := c.Query("key_name"); v != "" {
+		query = query.Where("key_name = ?", v)
+	}
+	if v := c.Query("action"); v != "" {
+		query = query.Where("action = ?", v)
+	}
+	for param, op := range map[string]string{"from": ">=", "to": "<"} {
+		v := c.Query(param)
+		if v == "" {
+			continue
+		}
+		t, err := parseAuditTime(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": fmt.Sprintf("Invalid %s, expected an RFC 3339 timestamp or YYYY-MM-DD", param),
+			})
+		}
+		query = query.Where("created_at "+op+" ?", t.UTC())
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		zlog.Error().Err(err).Msg("getAuditLogHandler: Failed to count audit entries")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve audit log"})
+	}
+	entries := []AuditEntry{}
+	if err := query.Order("created_at desc, id desc").Limit(limit).Offset(offset).Find(&entries).Error; err != nil {
+		zlog.Error().Err(err).Msg("getAuditLogHandler: Failed to retrieve audit entries")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve audit log"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":       entries,
+		"pagination": newPaginationData(page, limit, total),
+	})
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiffEvents(t *testing.T) {
+	date := time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+	before := Event{ID: 1, Date: date, Title: "Genesis", Tags: StringList{"bitcoin"}, UpdatedAt: time.Now()}
+	after := before
+	after.Title = "Genesis block"
+	after.Tags = StringList{"bitcoin", "genesis"}
+	after.UpdatedAt = time.Now().Add(time.Minute)
+
+	diff, err := diffEvents(&before, &after)
+	if err != nil {
+		t.Fatalf("diffEvents failed: %v", err)
+	}
+	if len(diff) != 2 || diff["title"].Before != "Genesis" || diff["title"].After != "Genesis block" {
+		t.Fatalf("expected title and tags to be the only changes, got %v", diff)
+	}
+	if _, ok := diff["tags"]; !ok {
+		t.Fatalf("expected a tags change, got %v", diff)
+	}
+
+	// Creations have every field with a null before
+	diff, err = diffEvents(nil, &after)
+	if err != nil {
+		t.Fatalf("diffEvents failed: %v", err)
+	}
+	if change, ok := diff["id"]; !ok || change.Before != nil || change.After != float64(1) {
+		t.Fatalf("expected the id to be recorded on creation, got %v", diff)
+	}
+	if _, ok := diff["updated_at"]; ok {
+		t.Fatalf("expected timestamps to be left out, got %v", diff)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	var err error
+	systemDB, err = InitSystemDB(filepath.Join(t.TempDir(), "system.db"))
+	if err != nil {
+		t.Fatalf("InitSystemDB failed: %v", err)
+	}
+	validAPIKeys, _ = parseAPIKeys("editor=events:write,root=admin")
+	defer func() { systemDB, validAPIKeys = nil, nil }()
+
+	api := newTestAPI(t, authMiddleware)
+	api.addLanguage("ru")
+	write := requireScope(scopeEventsWrite)
+	api.Post("/events", write, createEventHandler)
+	api.Patch("/events/:id", write, patchEventHandler)
+	api.Delete("/events/:id", write, deleteEventHandler)
+	api.Get("/admin/audit", requireScope(scopeAdmin), getAuditLogHandler)
+
+	do := func(method, path, key, body string) *http.Response {
+		return api.request(method, path, body, "X-API-KEY", key)
+	}
+	query := func(params string) []AuditEntry {
+		res := do(http.MethodGet, "/api/admin/audit"+params, "root", "")
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 OK for %q, got %d", params, res.StatusCode)
+		}
+		var body struct {
+			Data []AuditEntry `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("failed to decode audit log: %v", err)
+		}
+		return body.Data
+	}
+
+	event := `{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "tags": ["bitcoin"]}`
+	if res := do(http.MethodPost, "/api/events", "editor", event); res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	if res := do(http.MethodPost, "/api/events?lang=ru", "editor", event); res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", res.StatusCode)
+	}
+	if res := do(http.MethodPatch, "/api/events/1", "editor", `{"title": "Genesis block"}`); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+	if res := do(http.MethodDelete, "/api/events/1", "editor", ""); res.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", res.StatusCode)
+	}
+
+	// 1. Everything is listed, newest first
+	entries := query("")
+	if len(entries) != 4 || entries[0].Action != auditDelete || entries[3].Action != auditCreate {
+		t.Fatalf("expected 4 entries newest first, got %+v", entries)
+	}
+
+	// 2. event_id is scoped to the request language
+	entries = query("?event_id=1")
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries for English event 1, got %+v", entries)
+	}
+	update := entries[1]
+	if update.Action != auditUpdate || update.KeyName != staticAPIKeyName("editor") || update.Lang != "en" {
+		t.Fatalf("unexpected update entry %+v", update)
+	}
+	if len(update.Diff) != 1 || update.Diff["title"].Before != "Genesis" || update.Diff["title"].After != "Genesis block" {
+		t.Fatalf("expected only the title in the update diff, got %v", update.Diff)
+	}
+	if deleted := entries[0].Diff["title"]; deleted.Before != "Genesis block" || deleted.After != nil {
+		t.Fatalf("expected the deleted content in the diff, got %v", entries[0].Diff)
+	}
+	if entries := query("?event_id=1&lang=ru"); len(entries) != 1 {
+		t.Fatalf("expected 1 entry for Russian event 1, got %+v", entries)
+	}
+
+	// 3. Key, action and time range filters
+	if entries := query("?key_name=API_KEYS%20%232&action=create"); len(entries) != 0 {
+		t.Fatalf("expected no entries for the admin key, got %+v", entries)
+	}
+	if entries := query("?action=create"); len(entries) != 2 {
+		t.Fatalf("expected 2 create entries, got %+v", entries)
+	}
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Format(fullDateLayout)
+	if entries := query("?from=" + tomorrow); len(entries) != 0 {
+		t.Fatalf("expected no entries from tomorrow, got %+v", entries)
+	}
+	if entries := query("?to=" + tomorrow); len(entries) != 4 {
+		t.Fatalf("expected 4 entries before tomorrow, got %+v", entries)
+	}
+	if res := do(http.MethodGet, "/api/admin/audit?from=yesterday", "root", ""); res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an invalid time, got %d", res.StatusCode)
+	}
+}
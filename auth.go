@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// Scopes that can be granted to an API key
+const (
+	scopeEventsRead  = "events:read"  // Read events, tags and reports
+	scopeEventsWrite = "events:write" // Create, update and delete events
+	scopeAdmin       = "admin"        // Tag management and other admin endpoints
+)
+
+// knownScopes lists the valid scopes, from the least to the most privileged
+var knownScopes = []string{scopeEventsRead, scopeEventsWrite, scopeAdmin}
+
+// impliedScopes lists the scopes granted along with a scope: editors can read,
+// admins can do everything.
+var impliedScopes = map[string][]string{
+	scopeEventsWrite: {scopeEventsRead},
+	scopeAdmin:       {scopeEventsRead, scopeEventsWrite},
+}
+
+// Key under which authMiddleware stores the request's *APIKey in c.Locals
+const localsAPIKey = "api_key"
+
+// staticAPIKey is a key configured through API_KEYS. It has no row in the
+// api_keys table; its APIKey only carries a name and the scopes.
+type staticAPIKey struct {
+	secret []byte
+	key    *APIKey
+}
+
+var validAPIKeys []staticAPIKey
+
+// anonymousAccess lets GET requests without an API key through with the
+// events:read scope, rate limited per IP address (ANONYMOUS_ACCESS=true)
+var anonymousAccess = false
+
+// anonymousRateLimit is the number of requests per minute allowed to an IP
+// address without an API key (ANONYMOUS_RATE_LIMIT_PER_MINUTE)
+var anonymousRateLimit int64 = 20
+
+// anonymousKeyName is the name of the APIKey of requests without a key
+const anonymousKeyName = "anonymous"
+
+// anonymousKey returns the read-only key under which a request without an API
+// key is served. It is rate limited by the client's IP address.
+func anonymousKey(c *fiber.Ctx) *APIKey {
+	return &APIKey{
+		Name:       anonymousKeyName,
+		Scopes:     StringList{scopeEventsRead},
+		RateLimit:  anonymousRateLimit,
+		limiterKey: "ip:" + c.IP(),
+	}
+}
+
+// isAnonymous reports whether the key stands for a request without an API key
+func (k *APIKey) isAnonymous() bool {
+	return k.ID == 0 && k.Name == anonymousKeyName
+}
+
+// loadAnonymousAccessConfig reads ANONYMOUS_ACCESS and ANONYMOUS_RATE_LIMIT_PER_MINUTE
+func loadAnonymousAccessConfig() error {
+	if v := os.Getenv("ANONYMOUS_ACCESS"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("ANONYMOUS_ACCESS must be true or false, got %q", v)
+		}
+		anonymousAccess = enabled
+	}
+	if v := os.Getenv("ANONYMOUS_RATE_LIMIT_PER_MINUTE"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("ANONYMOUS_RATE_LIMIT_PER_MINUTE must be a positive integer, got %q", v)
+		}
+		anonymousRateLimit = n
+	}
+	return nil
+}
+
+// parseAPIKeys parses the API_KEYS value: comma-separated keys, each optionally
+// followed by "=" and a "|"-separated list of scopes, e.g.
+// "widgetkey=events:read,editorkey=events:write,adminkey=admin". A key without
+// scopes is granted every scope, as all keys were before scopes existed. The
+// scopes follow the last "=", and trailing "=" are part of the key, so base64
+// keys with padding such as "c2VjcmV0==" or "c2VjcmV0===events:read" work.
+func parseAPIKeys(s string) ([]staticAPIKey, error) {
+	var keys []staticAPIKey
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		secret, scopeList, hasScopes := entry, "", false
+		if i := strings.LastIndex(entry, "="); i >= 0 && strings.TrimSpace(entry[i+1:]) != "" {
+			secret, scopeList, hasScopes = entry[:i], entry[i+1:], true
+		}
+		secret = strings.TrimSpace(secret)
+		if secret == "" {
+			continue
+		}
+
+		key := staticAPIKey{secret: []byte(secret), key: &APIKey{Name: staticAPIKeyName(secret)}}
+		if !hasScopes {
+			key.key.Scopes = slices.Clone(knownScopes)
+		} else {
+			for _, scope := range strings.Split(scopeList, "|") {
+				scope = strings.TrimSpace(scope)
+				if !slices.Contains(knownScopes, scope) {
+					return nil, fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(knownScopes, ", "))
+				}
+				key.key.Scopes = append(key.key.Scopes, scope)
+			}
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// staticAPIKeyName names a key from API_KEYS after the start of the hash of its
+// secret, so audit entries, rate limit counters and idempotency keys stay with
+// the key when API_KEYS is reordered, without revealing the secret
+func staticAPIKeyName(secret string) string {
+	return "API_KEYS " + hashAPIKey(secret)[:8]
+}
+
+// hasScope reports whether the granted scopes include scope, directly or implied
+func hasScope(granted []string, scope string) bool {
+	for _, g := range granted {
+		if g == scope || slices.Contains(impliedScopes[g], scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// findStaticAPIKey returns the key configured in API_KEYS with the given secret, or nil
+func findStaticAPIKey(secret string) *APIKey {
+	secretBytes := []byte(secret)
+	for _, expectedKey := range validAPIKeys {
+		// Securely compare the provided key with each of the expected keys
+		if subtle.ConstantTimeCompare(secretBytes, expectedKey.secret) == 1 {
+			return expectedKey.key
+		}
+	}
+	return nil
+}
+
+// knownAPIKey reports whether authMiddleware accepts secret without querying
+// the system database: a key from API_KEYS or a stored key it has cached
+func knownAPIKey(secret string) bool {
+	return findStaticAPIKey(secret) != nil || isCachedAPIKey(secret)
+}
+
+// authMiddleware checks for a valid API key, either configured in API_KEYS or
+// stored in the api_keys table, and stores it in c.Locals for requireScope.
+// With anonymous access enabled, GET requests without a key get the anonymous key.
+func authMiddleware(c *fiber.Ctx) error {
+	providedKey := c.Get("X-API-KEY")
+	if providedKey == "" {
+		if anonymousAccess && (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead) {
+			c.Locals(localsAPIKey, anonymousKey(c))
+			return c.Next()
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key required"})
+	}
+
+	if key := findStaticAPIKey(providedKey); key != nil {
+		c.Locals(localsAPIKey, key)
+		return c.Next()
+	}
+
+	if systemDB != nil {
+		key, err := lookupAPIKey(systemDB, providedKey)
+		if err != nil {
+			zlog.Error().Err(err).Msg("authMiddleware: Failed to look up API key")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to verify API key"})
+		}
+		if key != nil {
+			c.Locals(localsAPIKey, key)
+			return c.Next()
+		}
+	}
+
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+}
+
+// requestAPIKey returns the API key authenticated by authMiddleware, or nil
+func requestAPIKey(c *fiber.Ctx) *APIKey {
+	key, _ := c.Locals(localsAPIKey).(*APIKey)
+	return key
+}
+
+// requireScope rejects requests whose API key lacks scope with 403 Forbidden,
+// or with 401 Unauthorized when the request has no API key
+func requireScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var granted []string
+		key := requestAPIKey(c)
+		if key != nil {
+			granted = key.Scopes
+		}
+		if !hasScope(granted, scope) {
+			if key != nil && key.isAnonymous() {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key required"})
+			}
+			zlog.Warn().Str("path", c.Path()).Str("required_scope", scope).Strs("scopes", granted).Msg("requireScope: Missing scope")
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error":          fmt.Sprintf("API key is missing the required scope '%s'", scope),
+				"required_scope": scope,
+			})
+		}
+		return c.Next()
+	}
+}
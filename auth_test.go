@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	keys, err := parseAPIKeys(" legacy , widget=events:read, editor=events:read|events:write,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %d", len(keys))
+	}
+	if !reflect.DeepEqual([]string(keys[0].key.Scopes), knownScopes) {
+		t.Fatalf("expected a key without scopes to get every scope, got %v", keys[0].key.Scopes)
+	}
+	if string(keys[1].secret) != "widget" || !reflect.DeepEqual([]string(keys[1].key.Scopes), []string{scopeEventsRead}) {
+		t.Fatalf("unexpected widget key: %s %v", keys[1].secret, keys[1].key.Scopes)
+	}
+
+	// Names do not depend on the position of the key
+	reordered, _ := parseAPIKeys("editor=events:read|events:write,widget=events:read")
+	if keys[2].key.Name != reordered[0].key.Name || keys[1].key.Name != reordered[1].key.Name || keys[1].key.Name == keys[2].key.Name {
+		t.Fatalf("expected names to follow the secrets, got %q %q and %q %q", keys[1].key.Name, keys[2].key.Name, reordered[0].key.Name, reordered[1].key.Name)
+	}
+	if name := keys[1].key.Name; name != "API_KEYS "+hashAPIKey("widget")[:8] || strings.Contains(name, "widget") {
+		t.Fatalf("expected the name to be derived from the hash of the secret, got %q", name)
+	}
+
+	if _, err := parseAPIKeys("key=events:delete"); err == nil {
+		t.Fatal("expected an error for an unknown scope")
+	}
+
+	// Base64 padding is part of the key, scopes follow the last "="
+	keys, err = parseAPIKeys("c2VjcmV0==, cmVhZGVy==events:read, d3JpdGVy=events:read|events:write")
+	if err != nil {
+		t.Fatalf("unexpected error for padded keys: %v", err)
+	}
+	want := []struct {
+		secret string
+		scopes []string
+	}{
+		{"c2VjcmV0==", knownScopes},
+		{"cmVhZGVy=", []string{scopeEventsRead}},
+		{"d3JpdGVy", []string{scopeEventsRead, scopeEventsWrite}},
+	}
+	for i, w := range want {
+		if string(keys[i].secret) != w.secret || !reflect.DeepEqual([]string(keys[i].key.Scopes), w.scopes) {
+			t.Errorf("key %d: expected %s %v, got %s %v", i, w.secret, w.scopes, keys[i].secret, keys[i].key.Scopes)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	keys, err := parseAPIKeys("reader=events:read,editor=events:write,root=admin")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	validAPIKeys = keys
+	defer func() { validAPIKeys = nil }()
+
+	app := fiber.New()
+	api := app.Group("/api", authMiddleware)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	api.Get("/events", requireScope(scopeEventsRead), ok)
+	api.Delete("/events/:id", requireScope(scopeEventsWrite), ok)
+	api.Post("/admin/tags/merge", requireScope(scopeAdmin), ok)
+
+	cases := []struct {
+		key, method, path string
+		status            int
+	}{
+		{"reader", http.MethodGet, "/api/events", http.StatusOK},
+		{"reader", http.MethodDelete, "/api/events/1", http.StatusForbidden},
+		{"editor", http.MethodDelete, "/api/events/1", http.StatusOK},
+		{"editor", http.MethodPost, "/api/admin/tags/merge", http.StatusForbidden},
+		{"root", http.MethodPost, "/api/admin/tags/merge", http.StatusOK},
+		{"root", http.MethodGet, "/api/events", http.StatusOK},
+		{"unknown", http.MethodGet, "/api/events", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("X-API-KEY", tc.key)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if res.StatusCode != tc.status {
+			t.Fatalf("%s %s with key %q: expected %d, got %d", tc.method, tc.path, tc.key, tc.status, res.StatusCode)
+		}
+		if res.StatusCode == http.StatusForbidden {
+			var body struct {
+				RequiredScope string `json:"required_scope"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if body.RequiredScope == "" {
+				t.Fatalf("expected the 403 response to name the missing scope")
+			}
+		}
+	}
+}
+
+func TestAnonymousAccess(t *testing.T) {
+	anonymousAccess, anonymousRateLimit, failedAuthRateLimit = true, 2, 2
+	limiterStorage = newMemoryLimiterStorage()
+	defer func() {
+		anonymousAccess, anonymousRateLimit, failedAuthRateLimit = false, 20, 20
+		limiterStorage = newMemoryLimiterStorage()
+	}()
+
+	app := fiber.New()
+	api := app.Group("/api", failedAuthLimiter(), authMiddleware, rateLimitMiddleware)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+	api.Get("/events", requireScope(scopeEventsRead), ok)
+	api.Post("/events", requireScope(scopeEventsWrite), ok)
+	api.Get("/admin/keys", requireScope(scopeAdmin), ok)
+
+	cases := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/api/events", http.StatusOK},
+		{http.MethodPost, "/api/events", http.StatusUnauthorized},
+		{http.MethodGet, "/api/admin/keys", http.StatusUnauthorized},
+		// The anonymous limit of 2 per minute is used up by the GET requests above
+		{http.MethodGet, "/api/events", http.StatusTooManyRequests},
+		// Writes without a key count as failed authentications, limited to 2
+		{http.MethodPost, "/api/events", http.StatusUnauthorized},
+		{http.MethodPost, "/api/events", http.StatusTooManyRequests},
+	}
+	for _, tc := range cases {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if res.StatusCode != tc.status {
+			t.Fatalf("anonymous %s %s: expected %d, got %d", tc.method, tc.path, tc.status, res.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Statuses of the items of a batch import
+const (
+	batchCreated  = "created"
+	batchUpdated  = "updated"  // With upsert, the item replaced the event with its external_id
+	batchInvalid  = "invalid"  // The item failed validation
+	batchConflict = "conflict" // Another event already has the item's external_id
+	batchFailed   = "failed"   // The database rejected the item
+	batchAborted  = "aborted"  // Valid, but not saved because another item failed in atomic mode
+)
+
+// BatchItemResult reports the outcome of one item of a batch import
+type BatchItemResult struct {
+	Index              int                 `json:"index"`
+	Status             string              `json:"status"`
+	ID                 uint                `json:"id,omitempty"`
+	Error              string              `json:"error,omitempty"`
+	PossibleDuplicates []PossibleDuplicate `json:"possible_duplicates,omitempty"` // Stored events, earlier items included, that the item may duplicate
+	replaced           *Event              // The updated event as it was before, for the audit log
+}
+
+// Handler for POST /api/events/batch?atomic=&upsert=
+// Validates every item like a single create. With atomic=true the batch is
+// saved in one transaction only if every item is valid and stored; otherwise
+// each valid item is saved on its own and failures are reported per item.
+// With upsert=true, items whose external_id is already stored update that event.
+func batchCreateEventsHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	atomic, upsert := c.QueryBool("atomic"), c.QueryBool("upsert")
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(c.Body(), &items); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON, expected an array of events"})
+	}
+	if len(items) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No events provided in the batch"})
+	}
+
+	results := make([]BatchItemResult, len(items))
+	events := make([]Event, len(items))
+	invalid := 0
+	for i, raw := range items {
+		results[i].Index = i
+		event, err := parseEventInput(raw, Event{})
+		if err != nil {
+			results[i].Status, results[i].Error = batchInvalid, err.Error()
+			invalid++
+			continue
+		}
+		events[i] = event
+	}
+
+	// Best-effort items are committed one by one, so the batch does not hold the
+	// write lock throughout and a failure only loses its item. A dry run writes
+	// them in savepoints of one transaction instead, which is rolled back as a
+	// whole and still reports the IDs the items would get.
+	var err error
+	if atomic || isDryRun(c) {
+		err = writeTransaction(c, db, func(tx *gorm.DB) error {
+			if atomic {
+				return saveBatchAtomically(c, tx, events, results, invalid > 0, upsert)
+			}
+			saveBatchItems(c, tx, lang, events, results, upsert)
+			return nil
+		})
+	} else {
+		saveBatchItems(c, db, lang, events, results, upsert)
+	}
+	if err != nil {
+		zlog.Error().Str("lang", lang).Bool("atomic", atomic).Err(err).Msg("batchCreateEventsHandler: Batch rolled back")
+		if !atomic {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create events in batch"})
+		}
+		abortValidItems(results)
+	}
+
+	var entries []AuditEntry
+	created, updated := 0, 0
+	for i := range results {
+		switch results[i].Status {
+		case batchCreated:
+			created++
+			entries = append(entries, newAuditEntry(c, auditCreate, lang, nil, &events[i]))
+		case batchUpdated:
+			updated++
+			entries = append(entries, newAuditEntry(c, auditUpdate, lang, results[i].replaced, &events[i]))
+		}
+	}
+	if !isDryRun(c) {
+		writeAudit(entries...)
+	}
+
+	zlog.Info().Str("lang", lang).Bool("atomic", atomic).Int("items", len(items)).Int("created", created).Int("updated", updated).Msg("batchCreateEventsHandler: Batch processed")
+	status := fiber.StatusCreated
+	switch {
+	case created+updated == 0:
+		status = fiber.StatusUnprocessableEntity
+	case created+updated < len(items):
+		status = fiber.StatusMultiStatus
+	case created == 0:
+		status = fiber.StatusOK
+	}
+	return c.Status(status).JSON(withDryRun(c, fiber.Map{
+		"data":           results,
+		"atomic":         atomic,
+		"events_added":   created,
+		"events_updated": updated,
+		"events_failed":  len(items) - created - updated,
+	}))
+}
+
+// saveBatchAtomically saves every item in tx, or returns an error so that
+// none of them is kept. An invalid item aborts the batch before any write.
+func saveBatchAtomically(c *fiber.Ctx, tx *gorm.DB, events []Event, results []BatchItemResult, hasInvalid, upsert bool) error {
+	if hasInvalid {
+		abortValidItems(results)
+		return nil
+	}
+	for i := range events {
+		if err := saveBatchItem(c, tx, &events[i], &results[i], upsert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveBatchItems saves each valid item in its own transaction of db, or its
+// own savepoint when db is a transaction, so a failed item is rolled back
+// without the others
+func saveBatchItems(c *fiber.Ctx, db *gorm.DB, lang string, events []Event, results []BatchItemResult, upsert bool) {
+	for i := range events {
+		if results[i].Status != "" {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			return saveBatchItem(c, tx, &events[i], &results[i], upsert)
+		})
+		if err == nil || results[i].Status == batchConflict {
+			continue
+		}
+		// The item may have been saved before its commit failed
+		results[i] = BatchItemResult{Index: i, Status: batchFailed, Error: "Failed to save event"}
+		zlog.Error().Str("lang", lang).Int("index", i).Err(err).Msg("batchCreateEventsHandler: Failed to save event")
+	}
+}
+
+// saveBatchItem saves an item with saveEvent, looks for possible duplicates
+// and records the outcome in result
+func saveBatchItem(c *fiber.Ctx, tx *gorm.DB, event *Event, result *BatchItemResult, upsert bool) error {
+	replaced, err := saveEvent(tx, c, event, upsert)
+	if err == nil {
+		result.PossibleDuplicates, err = findPossibleDuplicates(tx, event, defaultDuplicateOptions)
+	}
+	var conflict *eventConflictError
+	switch {
+	case errors.As(err, &conflict):
+		result.Status, result.Error = batchConflict, conflict.Error()
+	case err != nil:
+		result.Status, result.Error, result.PossibleDuplicates = batchFailed, "Failed to save event", nil
+	case replaced != nil:
+		result.Status, result.ID, result.replaced = batchUpdated, event.ID, replaced
+	default:
+		result.Status, result.ID = batchCreated, event.ID
+	}
+	return err
+}
+
+// abortValidItems marks the items that were valid, or saved in a rolled back
+// transaction, as aborted
+func abortValidItems(results []BatchItemResult) {
+	for i := range results {
+		switch results[i].Status {
+		case "", batchCreated, batchUpdated:
+			results[i].Status, results[i].ID, results[i].replaced, results[i].PossibleDuplicates = batchAborted, 0, nil, nil
+		}
+	}
+}
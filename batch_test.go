@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestBatchCreateEvents(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events/batch", batchCreateEventsHandler)
+
+	type report struct {
+		Data         []BatchItemResult `json:"data"`
+		EventsAdded  int               `json:"events_added"`
+		EventsFailed int               `json:"events_failed"`
+		Error        string            `json:"error"`
+	}
+	do := func(path, body string) (int, report) {
+		var decoded report
+		return api.do(http.MethodPost, path, body, &decoded), decoded
+	}
+	countEvents := func() int64 {
+		var count int64
+		db.Model(&Event{}).Count(&count)
+		return count
+	}
+
+	mixed := `[
+		{"title": "Genesis", "date": "2009-01-03T00:00:00Z"},
+		{"title": "No date"},
+		{"title": "Pizza day", "date": "2010-05-22T00:00:00Z", "id": 3}
+	]`
+
+	// 1. Best effort: valid items are created, the others are reported
+	status, got := do("/api/events/batch", mixed)
+	if status != http.StatusMultiStatus || got.EventsAdded != 1 || got.EventsFailed != 2 {
+		t.Fatalf("expected 207 with 1 event added, got %d %+v", status, got)
+	}
+	want := []BatchItemResult{
+		{Index: 0, Status: batchCreated, ID: 1},
+		{Index: 1, Status: batchInvalid, Error: "Title and Date are required fields"},
+		{Index: 2, Status: batchInvalid, Error: "Field 'id' is read-only"},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got.Data[i], want[i]) {
+			t.Errorf("item %d: expected %+v, got %+v", i, want[i], got.Data[i])
+		}
+	}
+	var revisions int64
+	db.Model(&EventRevision{}).Count(&revisions)
+	if revisions != 1 {
+		t.Fatalf("expected a revision for the created event, got %d", revisions)
+	}
+
+	// 2. Atomic: one invalid item aborts the whole batch
+	status, got = do("/api/events/batch?atomic=true", mixed)
+	if status != http.StatusUnprocessableEntity || got.EventsAdded != 0 {
+		t.Fatalf("expected 422 with nothing added, got %d %+v", status, got)
+	}
+	if got.Data[0].Status != batchAborted || got.Data[0].ID != 0 || got.Data[2].Status != batchInvalid {
+		t.Fatalf("expected the valid item to be aborted, got %+v", got.Data)
+	}
+	if count := countEvents(); count != 1 {
+		t.Fatalf("expected the atomic batch to add nothing, got %d events", count)
+	}
+
+	// 3. Atomic: a valid batch is created as a whole
+	status, got = do("/api/events/batch?atomic=true", `[
+		{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"},
+		{"title": "Mt. Gox", "date": "2014-02-24T00:00:00Z", "tags": ["exchange"]}
+	]`)
+	if status != http.StatusCreated || got.EventsAdded != 2 || got.Data[1].ID != 3 {
+		t.Fatalf("expected 201 with events 2 and 3, got %d %+v", status, got)
+	}
+
+	// 4. The body must be a non-empty array
+	for _, body := range []string{`{"title": "Genesis"}`, `[]`} {
+		if status, got := do("/api/events/batch", body); status != http.StatusBadRequest || got.Error == "" {
+			t.Errorf("%s: expected 400, got %d %+v", body, status, got)
+		}
+	}
+}
@@ -20,8 +20,9 @@ func setupAppForTests() *fiber.App {
 	// Apply the same CORS middleware as in production.
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     getAllowedOrigins(),
-		AllowMethods:     "GET,HEAD,OPTIONS,POST,PUT,DELETE",
-		AllowHeaders:     "X-API-KEY,Content-Type",
+		AllowMethods:     "GET,HEAD,OPTIONS,POST,PUT,PATCH,DELETE",
+		AllowHeaders:     "X-API-KEY,Content-Type,If-Match,Idempotency-Key",
+		ExposeHeaders:    "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After,Content-Language,ETag,Idempotent-Replayed",
 		AllowCredentials: false,
 	}))
 
@@ -1,6 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"gorm.io/driver/sqlite"
@@ -10,16 +16,119 @@ import (
 
 // Event matches the schema defined in Calendar API Spec.md
 type Event struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Date        time.Time `json:"date" gorm:"type:date;not null"`
-	Title       string    `json:"title" gorm:"size:255;not null"`
-	Description string    `json:"description" gorm:"type:text"`
-	Tags        string    `json:"tags" gorm:"size:500"`        // JSON array as string
-	Media       string    `json:"media" gorm:"type:text"`      // Link to media file(s), stored as a JSON array string e.g., ["url1", "url2"]
-	References  string    `json:"references" gorm:"type:text"` // JSON array as string
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Rank        float64   `json:"-" gorm:"-"` // Omit from JSON and DB schema
+	ID               uint           `json:"id" gorm:"primaryKey"`
+	Date             time.Time      `json:"date" gorm:"type:date;not null"`
+	Title            string         `json:"title" gorm:"size:255;not null"`
+	Description      string         `json:"description" gorm:"type:text"`
+	Tags             StringList     `json:"tags" gorm:"size:500"`                              // Stored as a JSON array string
+	Media            StringList     `json:"media" gorm:"type:text"`                            // Link to media file(s), stored as a JSON array string e.g., ["url1", "url2"]
+	References       ReferenceList  `json:"references" gorm:"type:text"`                       // Stored as a JSON array of reference objects
+	TranslationGroup string         `json:"translation_group,omitempty" gorm:"size:64"`        // Shared by all language variants of the same event
+	ExternalID       *string        `json:"external_id,omitempty" gorm:"size:255;uniqueIndex"` // Stable key of imported events, unique among all events of the language including trashed ones
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`              // Set when the event is in the trash; GORM queries skip trashed events
+	Rank             float64        `json:"-" gorm:"-"`                  // Omit from JSON and DB schema
+	Fallback         bool           `json:"fallback,omitempty" gorm:"-"` // Set when served from the default language instead of the requested one
+}
+
+// errInvalidStringList is returned when a tags or media value is not a JSON array of strings
+var errInvalidStringList = errors.New("tags and media must be JSON arrays of strings")
+
+// isEventFieldError reports whether err is a validation error of an event field
+// that should be returned to the client as a 400
+func isEventFieldError(err error) bool {
+	return errors.Is(err, errInvalidStringList) || errors.Is(err, errInvalidReferences)
+}
+
+// StringList is a list of strings stored as a JSON array in a text column and
+// serialized as a real JSON array in the API.
+type StringList []string
+
+// GormDataType keeps the column type of the former plain string fields
+func (StringList) GormDataType() string {
+	return "string"
+}
+
+// Value stores the list as a JSON array string, an empty list as "[]"
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]string(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads a JSON array string from the database. Empty values become an
+// empty list, and legacy values that are not a JSON array of strings (e.g. a
+// bare media URL) are kept as a single item rather than failing the query.
+func (l *StringList) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+
+	raw = strings.TrimSpace(raw)
+	*l = StringList{}
+	if raw == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), (*[]string)(l)); err != nil {
+		*l = StringList{raw}
+	}
+	return nil
+}
+
+// MarshalJSON always renders an array, never null
+func (l StringList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(l))
+}
+
+// UnmarshalJSON accepts a JSON array of strings. For existing consumers it also
+// accepts the legacy form, a string holding a JSON array (e.g. "[\"a\",\"b\"]").
+func (l *StringList) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*l = StringList{}
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var legacy string
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return errInvalidStringList
+		}
+		if strings.TrimSpace(legacy) == "" {
+			*l = StringList{}
+			return nil
+		}
+		b = []byte(legacy)
+	}
+
+	var items []string
+	if err := json.Unmarshal(b, &items); err != nil || items == nil {
+		return errInvalidStringList
+	}
+	*l = items
+	return nil
+}
+
+// nowUTC is the clock of the language databases, so created_at, updated_at and
+// deleted_at are stored in UTC whatever the server's time zone, and compare
+// correctly with UTC bounds
+func nowUTC() time.Time {
+	return time.Now().UTC()
 }
 
 // InitDB initializes the database connection and migrates the schema.
@@ -28,14 +137,15 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 	var err error
 	var localDB *gorm.DB // Use a local variable for the DB instance
 	localDB, err = gorm.Open(sqlite.Open(dbPath+"?_journal_mode=WAL&_synchronous=NORMAL&_cache_size=10000"), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Silent), // Or logger.Info for more logs
+		Logger:  logger.Default.LogMode(logger.Silent), // Or logger.Info for more logs
+		NowFunc: nowUTC,
 	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Migrate the schema
-	err = localDB.AutoMigrate(&Event{})
+	err = localDB.AutoMigrate(&Event{}, &EventRevision{})
 	if err != nil {
 		return nil, err
 	}
@@ -104,6 +214,11 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 		}
 	}
 
+	// Normalized tag tables, kept in sync with the JSON tags column by triggers
+	if err := initTagTables(localDB); err != nil {
+		return nil, err
+	}
+
 	// Create indexes
 	if !localDB.Migrator().HasIndex(&Event{}, "idx_events_date") {
 		err = localDB.Exec("CREATE INDEX IF NOT EXISTS idx_events_date ON events(date)").Error
@@ -111,8 +226,8 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 			return nil, err
 		}
 	}
-	if !localDB.Migrator().HasIndex(&Event{}, "idx_events_tags") { // Uncommenting Tags index
-		err = localDB.Exec("CREATE INDEX IF NOT EXISTS idx_events_tags ON events(tags)").Error
+	if !localDB.Migrator().HasIndex(&Event{}, "idx_events_translation_group") {
+		err = localDB.Exec("CREATE INDEX IF NOT EXISTS idx_events_translation_group ON events(translation_group)").Error
 		if err != nil {
 			return nil, err
 		}
@@ -120,3 +235,20 @@ func InitDB(dbPath string) (*gorm.DB, error) {
 
 	return localDB, nil // Return the initialized DB instance
 }
+
+// systemDB holds the tables that are shared by all languages, such as API keys
+var systemDB *gorm.DB
+
+// InitSystemDB opens the system database and migrates its tables
+func InitSystemDB(dbPath string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dbPath+"?_journal_mode=WAL&_synchronous=NORMAL"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&APIKey{}, &AuditEntry{}, &IdempotencyRecord{}); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStringListUnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		input string
+		want  StringList
+	}{
+		{`["a", "b"]`, StringList{"a", "b"}},
+		{`[]`, StringList{}},
+		{`null`, StringList{}},
+		{`""`, StringList{}},
+		{`"[\"a\",\"b\"]"`, StringList{"a", "b"}}, // Legacy JSON-encoded string
+	}
+	for _, tc := range cases {
+		var got StringList
+		if err := json.Unmarshal([]byte(tc.input), &got); err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.input, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: got %#v, want %#v", tc.input, got, tc.want)
+		}
+	}
+
+	for _, input := range []string{`"https://example.com/a.png"`, `"[\"a\""`, `[1, 2]`, `{"a": "b"}`, `42`} {
+		var got StringList
+		if err := json.Unmarshal([]byte(input), &got); !errors.Is(err, errInvalidStringList) {
+			t.Fatalf("%s: expected errInvalidStringList, got %v", input, err)
+		}
+	}
+}
+
+func TestStringListScan(t *testing.T) {
+	cases := []struct {
+		input interface{}
+		want  StringList
+	}{
+		{nil, StringList{}},
+		{"", StringList{}},
+		{[]byte(`["a","b"]`), StringList{"a", "b"}},
+		{"https://example.com/a.png", StringList{"https://example.com/a.png"}}, // Legacy bare value
+	}
+	for _, tc := range cases {
+		var got StringList
+		if err := got.Scan(tc.input); err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.input, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%v: got %#v, want %#v", tc.input, got, tc.want)
+		}
+	}
+
+	if v, _ := StringList(nil).Value(); v != "[]" {
+		t.Fatalf("expected an empty list to be stored as [], got %v", v)
+	}
+}
+
+func TestLegacyStringsMiddleware(t *testing.T) {
+	app := fiber.New()
+	for path, body := range map[string]fiber.Map{
+		"/event":      {"data": fiber.Map{"id": 1, "title": "Genesis", "tags": []string{"mining"}, "references": []fiber.Map{{"url": "https://example.com", "title": "Example"}}}},
+		"/variants":   {"data": fiber.Map{"en": fiber.Map{"id": 1, "title": "Genesis", "media": []string{}}}},
+		"/month":      {"days": []fiber.Map{{"date": "01-03", "events": []fiber.Map{{"id": 1, "title": "Genesis", "tags": []string{"mining"}}}}}},
+		"/not-events": {"data": []fiber.Map{{"tags": []string{"mining"}}}, "diff": fiber.Map{"tags": fiber.Map{"before": []string{}}}},
+	} {
+		app.Get(path, legacyStringsMiddleware, func(c *fiber.Ctx) error { return c.JSON(body) })
+	}
+
+	tests := map[string]string{
+		"/event":      `{"data":{"id":1,"references":"[\"https://example.com\"]","tags":"[\"mining\"]","title":"Genesis"}}`,
+		"/variants":   `{"data":{"en":{"id":1,"media":"[]","title":"Genesis"}}}`,
+		"/month":      `{"days":[{"date":"01-03","events":[{"id":1,"tags":"[\"mining\"]","title":"Genesis"}]}]}`,
+		"/not-events": `{"data":[{"tags":["mining"]}],"diff":{"tags":{"before":[]}}}`,
+	}
+	for path, want := range tests {
+		req, _ := http.NewRequest(http.MethodGet, path+"?legacy_strings=true", nil)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		got, _ := io.ReadAll(res.Body)
+		if string(got) != want {
+			t.Errorf("%s: expected %s, got %s", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// errDryRun rolls back the transaction of a dry run once its writes succeeded
+var errDryRun = errors.New("dry run")
+
+// isDryRun reports whether the request asked for ?dry_run=true: the write is
+// validated and applied in a transaction that is then rolled back
+func isDryRun(c *fiber.Ctx) bool {
+	return c.QueryBool("dry_run")
+}
+
+// writeTransaction runs fn in a transaction. It commits when fn succeeds,
+// except for dry runs, which are rolled back and still report success so the
+// caller can answer with the would-be result.
+func writeTransaction(c *fiber.Ctx, db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if isDryRun(c) {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return nil
+	}
+	return err
+}
+
+// withDryRun marks the response body of a dry run, which changed nothing
+func withDryRun(c *fiber.Ctx, body fiber.Map) fiber.Map {
+	if isDryRun(c) {
+		body["dry_run"] = true
+	}
+	return body
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDryRun(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events", createEventHandler)
+	api.Post("/events/batch", batchCreateEventsHandler)
+	api.Put("/events/:id", updateEventHandler)
+	api.Patch("/events/:id", patchEventHandler)
+	api.Delete("/events/:id", deleteEventHandler)
+
+	do := func(method, path, ifMatch, body string, out interface{}) int {
+		return api.do(method, path, body, out, "If-Match", ifMatch)
+	}
+	stored := func() (events, revisions int64) {
+		db.Unscoped().Model(&Event{}).Count(&events)
+		db.Model(&EventRevision{}).Count(&revisions)
+		return events, revisions
+	}
+
+	existing := Event{Title: "Genesis", Date: time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC), Description: "First block"}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	type single struct {
+		Data   Event `json:"data"`
+		DryRun bool  `json:"dry_run"`
+	}
+
+	// 1. Create reports the ID it would assign
+	var created single
+	status := do(http.MethodPost, "/api/events?dry_run=true", "", `{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"}`, &created)
+	if status != http.StatusCreated || !created.DryRun || created.Data.ID != 2 {
+		t.Fatalf("expected a dry-run event with ID 2, got %d %+v", status, created)
+	}
+	if status := do(http.MethodPost, "/api/events?dry_run=true", "", `{"title": "No date"}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("expected dry runs to be validated, got %d", status)
+	}
+
+	// 2. Updates return the would-be event
+	var patched single
+	if status := do(http.MethodPatch, "/api/events/1?dry_run=true", "", `{"description": "Dry"}`, &patched); status != http.StatusOK || patched.Data.Description != "Dry" || !patched.DryRun {
+		t.Fatalf("expected the patched event, got %d %+v", status, patched)
+	}
+	if status := do(http.MethodPut, "/api/events/1?dry_run=true", "", `{"title": "Genesis block", "date": "2009-01-03T00:00:00Z"}`, &patched); status != http.StatusOK || patched.Data.Description != "" {
+		t.Fatalf("expected the replaced event, got %d %+v", status, patched)
+	}
+	if status := do(http.MethodPatch, "/api/events/1?dry_run=true", `"1-0"`, `{"description": "Dry"}`, nil); status != http.StatusPreconditionFailed {
+		t.Fatalf("expected dry runs to detect a stale If-Match, got %d", status)
+	}
+
+	// 3. Deletes answer with the event instead of 204
+	var deleted single
+	if status := do(http.MethodDelete, "/api/events/1?dry_run=true", "", "", &deleted); status != http.StatusOK || deleted.Data.ID != 1 {
+		t.Fatalf("expected 200 with the event, got %d %+v", status, deleted)
+	}
+
+	// 4. Batches report the IDs of every item and the items that would fail
+	var batch struct {
+		Data   []BatchItemResult `json:"data"`
+		DryRun bool              `json:"dry_run"`
+	}
+	status = do(http.MethodPost, "/api/events/batch?dry_run=true", "", `[
+		{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"},
+		{"title": "No date"},
+		{"title": "Mt. Gox", "date": "2014-02-24T00:00:00Z"}
+	]`, &batch)
+	if status != http.StatusMultiStatus || !batch.DryRun || batch.Data[0].ID != 2 || batch.Data[1].Status != batchInvalid || batch.Data[2].ID != 3 {
+		t.Fatalf("expected IDs 2 and 3 and an invalid item, got %d %+v", status, batch)
+	}
+
+	// Nothing was written
+	if events, revisions := stored(); events != 1 || revisions != 0 {
+		t.Fatalf("expected dry runs to leave 1 event and no revisions, got %d and %d", events, revisions)
+	}
+	var event Event
+	if err := db.First(&event, 1).Error; err != nil || event.Description != "First block" || event.Title != "Genesis" {
+		t.Fatalf("expected event 1 unchanged, got %+v (%v)", event, err)
+	}
+}
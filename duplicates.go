@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// duplicateOptions are the thresholds of the duplicate detector. Two events
+// are candidate duplicates when their dates are at most days apart and their
+// titles are at least threshold similar, or they share a reference.
+type duplicateOptions struct {
+	days      int
+	threshold float64 // Title similarity from 0 to 1
+}
+
+// Thresholds used for the warnings of create and batch responses, and by the
+// report when the request does not set them
+var defaultDuplicateOptions = duplicateOptions{days: 1, threshold: 0.7}
+
+// DuplicateEvidence is why two events look like duplicates
+type DuplicateEvidence struct {
+	DateDistance     int      `json:"date_distance_days"`
+	TitleSimilarity  float64  `json:"title_similarity"`
+	SharedReferences []string `json:"shared_references,omitempty"`
+}
+
+// PossibleDuplicate is a stored event that a written event may duplicate,
+// returned as a warning by create and batch
+type PossibleDuplicate struct {
+	ID    uint      `json:"id"`
+	Title string    `json:"title"`
+	Date  time.Time `json:"date"`
+	DuplicateEvidence
+}
+
+// DuplicatePair is a pair of candidate duplicates in a DuplicateGroup
+type DuplicatePair struct {
+	EventIDs [2]uint `json:"event_ids"`
+	DuplicateEvidence
+}
+
+// DuplicateGroup is a set of events linked by candidate duplicate pairs
+type DuplicateGroup struct {
+	Events []Event         `json:"events"`
+	Pairs  []DuplicatePair `json:"pairs"`
+}
+
+// normalizeTitle lowercases a title and reduces it to words of letters and
+// digits, so emoji, punctuation and spacing do not count
+func normalizeTitle(title string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// titleSimilarity is the Sørensen–Dice coefficient of the character bigrams
+// of two normalized titles: 1 for equal titles, 0 for titles sharing no bigram
+func titleSimilarity(a, b string) float64 {
+	a, b = normalizeTitle(a), normalizeTitle(b)
+	if a == b {
+		return 1
+	}
+	bigrams := func(s string) map[string]int {
+		runes := []rune(s)
+		counts := make(map[string]int, len(runes))
+		for i := 0; i+1 < len(runes); i++ {
+			counts[string(runes[i:i+2])]++
+		}
+		return counts
+	}
+	countsA, countsB := bigrams(a), bigrams(b)
+	total, shared := 0, 0
+	for bigram, n := range countsA {
+		total += n
+		shared += min(n, countsB[bigram])
+	}
+	for _, n := range countsB {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Round(2*float64(shared)/float64(total)*100) / 100
+}
+
+// normalizeReferenceURL reduces a URL to its host and path, so the same page
+// linked with another scheme, "www." or a trailing slash is recognized
+func normalizeReferenceURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimSpace(raw))
+	}
+	key := strings.TrimPrefix(strings.ToLower(u.Host), "www.") + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
+
+// sharedReferences returns the URLs of b's references that a also cites.
+// References without a URL are never shared.
+func sharedReferences(a, b *Event) []string {
+	cited := make(map[string]bool, len(a.References))
+	for _, ref := range a.References {
+		if key := normalizeReferenceURL(ref.URL); key != "" {
+			cited[key] = true
+		}
+	}
+	var shared []string
+	for _, ref := range b.References {
+		key := normalizeReferenceURL(ref.URL)
+		if key != "" && cited[key] && !slices.Contains(shared, ref.URL) {
+			shared = append(shared, ref.URL)
+		}
+	}
+	return shared
+}
+
+// dateDistance is the number of calendar days between the dates of two events
+func dateDistance(a, b *Event) int {
+	dayA := time.Date(a.Date.Year(), a.Date.Month(), a.Date.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Date.Year(), b.Date.Month(), b.Date.Day(), 0, 0, 0, 0, time.UTC)
+	return int(math.Abs(dayA.Sub(dayB).Hours() / 24))
+}
+
+// compareEvents reports whether two events are candidate duplicates, and why
+func compareEvents(a, b *Event, opts duplicateOptions) (DuplicateEvidence, bool) {
+	evidence := DuplicateEvidence{DateDistance: dateDistance(a, b)}
+	if evidence.DateDistance > opts.days {
+		return evidence, false
+	}
+	evidence.TitleSimilarity = titleSimilarity(a.Title, b.Title)
+	evidence.SharedReferences = sharedReferences(a, b)
+	return evidence, evidence.TitleSimilarity >= opts.threshold || len(evidence.SharedReferences) > 0
+}
+
+// findPossibleDuplicates returns the stored events that event may duplicate
+func findPossibleDuplicates(tx *gorm.DB, event *Event, opts duplicateOptions) ([]PossibleDuplicate, error) {
+	var candidates []Event
+	if err := tx.Where("strftime('%Y-%m-%d', date) BETWEEN ? AND ? AND id <> ?",
+		event.Date.AddDate(0, 0, -opts.days).Format(fullDateLayout),
+		event.Date.AddDate(0, 0, opts.days).Format(fullDateLayout),
+		event.ID).Order("id asc").Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	var duplicates []PossibleDuplicate
+	for i := range candidates {
+		if evidence, ok := compareEvents(event, &candidates[i], opts); ok {
+			duplicates = append(duplicates, PossibleDuplicate{
+				ID:                candidates[i].ID,
+				Title:             candidates[i].Title,
+				Date:              candidates[i].Date,
+				DuplicateEvidence: evidence,
+			})
+		}
+	}
+	return duplicates, nil
+}
+
+// findDuplicateGroups compares every pair of events at most opts.days apart
+// and groups the candidate duplicates, transitively. events must be sorted by
+// date. Groups are in the order of their earliest event.
+func findDuplicateGroups(events []Event, opts duplicateOptions) []DuplicateGroup {
+	// Union-find over the indexes of events
+	parent := make([]int, len(events))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+
+	type indexedPair struct {
+		a, b int
+		DuplicateEvidence
+	}
+	var pairs []indexedPair
+	linked := make([]bool, len(events))
+	for i := range events {
+		for j := i + 1; j < len(events) && dateDistance(&events[i], &events[j]) <= opts.days; j++ {
+			if evidence, ok := compareEvents(&events[i], &events[j], opts); ok {
+				pairs = append(pairs, indexedPair{i, j, evidence})
+				linked[i], linked[j] = true, true
+				parent[root(j)] = root(i)
+			}
+		}
+	}
+
+	groupOf := map[int]int{} // Root index to position in groups
+	var groups []DuplicateGroup
+	for i := range events {
+		if !linked[i] {
+			continue
+		}
+		r := root(i)
+		g, ok := groupOf[r]
+		if !ok {
+			g = len(groups)
+			groupOf[r] = g
+			groups = append(groups, DuplicateGroup{})
+		}
+		groups[g].Events = append(groups[g].Events, events[i])
+	}
+	for _, p := range pairs {
+		g := groupOf[root(p.a)]
+		groups[g].Pairs = append(groups[g].Pairs, DuplicatePair{
+			EventIDs:          [2]uint{events[p.a].ID, events[p.b].ID},
+			DuplicateEvidence: p.DuplicateEvidence,
+		})
+	}
+	return groups
+}
+
+// parseDuplicateOptions reads the days and threshold query parameters
+func parseDuplicateOptions(c *fiber.Ctx) (duplicateOptions, error) {
+	opts := defaultDuplicateOptions
+	if v := c.Query("days"); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil || days < 0 || days > 366 {
+			return opts, errors.New("'days' must be an integer from 0 to 366")
+		}
+		opts.days = days
+	}
+	if v := c.Query("threshold"); v != "" {
+		threshold, err := strconv.ParseFloat(v, 64)
+		if err != nil || threshold <= 0 || threshold > 1 {
+			return opts, errors.New("'threshold' must be a number above 0 and at most 1")
+		}
+		opts.threshold = threshold
+	}
+	return opts, nil
+}
+
+// Handler for GET /api/admin/duplicates?days=&threshold=
+// Reports groups of events that look like duplicates of each other: dates at
+// most days apart, and titles at least threshold similar or a shared reference.
+func getDuplicatesHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	opts, err := parseDuplicateOptions(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, limit, offset := parsePagination(c)
+
+	var events []Event
+	if err := db.Order("date asc, id asc").Find(&events).Error; err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("getDuplicatesHandler: Failed to retrieve events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve events"})
+	}
+	groups := findDuplicateGroups(events, opts)
+
+	total := len(groups)
+	groups = groups[min(offset, total):min(offset+limit, total)]
+	if groups == nil {
+		groups = []DuplicateGroup{}
+	}
+	zlog.Info().Str("lang", lang).Int("events", len(events)).Int("groups", total).Msg("getDuplicatesHandler: Duplicates reported")
+	return c.JSON(fiber.Map{
+		"data":       groups,
+		"pagination": newPaginationData(page, limit, int64(total)),
+	})
+}
+
+// DuplicateMergeRequest is the body of POST /api/admin/duplicates/merge
+type DuplicateMergeRequest struct {
+	TargetID uint `json:"target_id"` // The event that is kept
+	SourceID uint `json:"source_id"` // The duplicate, moved to the trash
+}
+
+// mergeDuplicateEvents adds the tags and references of source that target
+// does not have yet to target, then moves source to the trash. It must run in
+// a transaction.
+func mergeDuplicateEvents(tx *gorm.DB, c *fiber.Ctx, target, source *Event) error {
+	tags := slices.Clone(target.Tags)
+	for _, tag := range source.Tags {
+		if !slices.ContainsFunc(tags, func(t string) bool { return normalizeTag(t) == normalizeTag(tag) }) {
+			tags = append(tags, tag)
+		}
+	}
+	references := slices.Clone(target.References)
+	for _, ref := range source.References {
+		if !slices.ContainsFunc(references, func(r Reference) bool { return normalizeReferenceURL(r.URL) == normalizeReferenceURL(ref.URL) }) {
+			references = append(references, ref)
+		}
+	}
+
+	if err := applyEventUpdate(tx, c, target, map[string]interface{}{"tags": tags, "references": references}, auditMerge); err != nil {
+		return err
+	}
+	return tx.Delete(&Event{}, source.ID).Error
+}
+
+// Handler for POST /api/admin/duplicates/merge
+// Merges a duplicate into the event that is kept: the kept event gets the
+// union of both events' tags and references, the duplicate goes to the trash.
+func mergeDuplicatesHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	var req DuplicateMergeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if req.TargetID == 0 || req.SourceID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "'target_id' and 'source_id' are required"})
+	}
+	if req.TargetID == req.SourceID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot merge an event into itself"})
+	}
+
+	var target, source Event
+	for _, e := range []struct {
+		id    uint
+		event *Event
+	}{{req.TargetID, &target}, {req.SourceID, &source}} {
+		if err := db.First(e.event, e.id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("Event %d not found", e.id)})
+			}
+			zlog.Error().Uint("id", e.id).Str("lang", lang).Err(err).Msg("mergeDuplicatesHandler: Failed to retrieve event")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		}
+	}
+
+	before := target
+	err := writeTransaction(c, db, func(tx *gorm.DB) error {
+		return mergeDuplicateEvents(tx, c, &target, &source)
+	})
+	if errors.Is(err, errEventModified) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Event was modified during the merge, retry"})
+	}
+	if err != nil {
+		zlog.Error().Uint("target_id", req.TargetID).Uint("source_id", req.SourceID).Str("lang", lang).Err(err).Msg("mergeDuplicatesHandler: Failed to merge events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to merge events"})
+	}
+	if !isDryRun(c) {
+		writeAudit(newAuditEntry(c, auditMerge, lang, &before, &target), newAuditEntry(c, auditDelete, lang, &source, nil))
+		zlog.Info().Uint("target_id", target.ID).Uint("source_id", source.ID).Str("lang", lang).Msg("mergeDuplicatesHandler: Events merged")
+	}
+	return c.JSON(withDryRun(c, fiber.Map{"data": target, "merged_id": source.ID}))
+}
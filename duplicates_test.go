@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTitleSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"Genesis block mined", "🎉 Genesis block mined!", 1, 1},
+		{"Bitcoin Pizza Day", "bitcoin pizza-day", 1, 1},
+		{"Genesis block mined", "Genesis block is mined", 0.7, 0.99},
+		{"Genesis block mined", "Mt. Gox files for bankruptcy", 0, 0.3},
+	}
+	for _, tt := range tests {
+		if got := titleSimilarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("titleSimilarity(%q, %q) = %v, expected %v to %v", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+	if got := normalizeReferenceURL("https://www.Example.com/post/"); got != normalizeReferenceURL("http://example.com/post") {
+		t.Errorf("expected scheme, www. and trailing slash to be ignored, got %q", got)
+	}
+}
+
+func TestSharedReferencesSkipEmptyURLs(t *testing.T) {
+	date := time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+	a := Event{Title: "Genesis block mined", Date: date, References: ReferenceList{{URL: ""}, {URL: "https://example.com/genesis"}}}
+	b := Event{Title: "Bitcoin v0.1 released", Date: date, References: ReferenceList{{URL: " "}}}
+	if shared := sharedReferences(&a, &b); shared != nil {
+		t.Fatalf("expected empty URLs not to be shared, got %q", shared)
+	}
+	if evidence, ok := compareEvents(&a, &b, duplicateOptions{days: 1, threshold: 0.7}); ok {
+		t.Fatalf("expected no duplicate, got %+v", evidence)
+	}
+	b.References = append(b.References, Reference{URL: "http://www.example.com/genesis/"})
+	if shared := sharedReferences(&a, &b); len(shared) != 1 || shared[0] != "http://www.example.com/genesis/" {
+		t.Fatalf("expected only the genesis URL to be shared, got %q", shared)
+	}
+}
+
+func TestDuplicateDetection(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events", createEventHandler)
+	api.Post("/events/batch", batchCreateEventsHandler)
+	api.Get("/admin/duplicates", getDuplicatesHandler)
+	api.Post("/admin/duplicates/merge", mergeDuplicatesHandler)
+
+	day := func(d int) time.Time { return time.Date(2009, 1, d, 0, 0, 0, 0, time.UTC) }
+	for _, e := range []Event{
+		{Title: "Genesis block mined", Date: day(3), Tags: StringList{"mining"}, References: ReferenceList{{URL: "https://example.com/genesis"}}},
+		{Title: "Satoshi releases Bitcoin v0.1", Date: day(9), References: ReferenceList{{URL: "https://example.com/v0.1"}}},
+		{Title: "Hal Finney receives bitcoin", Date: day(12)},
+		{Title: "Genesis block mined", Date: day(20)},
+	} {
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	// 1. Create warns about a similar title on a nearby date
+	var created struct {
+		Data               Event               `json:"data"`
+		PossibleDuplicates []PossibleDuplicate `json:"possible_duplicates"`
+	}
+	status := api.do(http.MethodPost, "/api/events", `{"title": "⛏️ Genesis block is mined", "date": "2009-01-04T00:00:00Z", "tags": ["Mining", "genesis"], "references": [{"url": "https://www.example.com/genesis/"}, {"url": "https://example.com/block-0"}]}`, &created)
+	if status != http.StatusCreated || len(created.PossibleDuplicates) != 1 {
+		t.Fatalf("expected 201 with one possible duplicate, got %d %+v", status, created.PossibleDuplicates)
+	}
+	if d := created.PossibleDuplicates[0]; d.ID != 1 || d.DateDistance != 1 || len(d.SharedReferences) != 1 {
+		t.Fatalf("expected event 1 a day apart with a shared reference, got %+v", d)
+	}
+	created.PossibleDuplicates = nil
+	if status := api.do(http.MethodPost, "/api/events", `{"title": "Bitcoin forum opens", "date": "2009-11-22T00:00:00Z"}`, &created); status != http.StatusCreated || created.PossibleDuplicates != nil {
+		t.Fatalf("expected no warning for a distinct event, got %d %+v", status, created.PossibleDuplicates)
+	}
+
+	// 2. Batch items are checked against stored events and earlier items
+	var batch struct {
+		Data []BatchItemResult `json:"data"`
+	}
+	status = api.do(http.MethodPost, "/api/events/batch", `[
+		{"title": "Bitcoin v0.1 announced", "date": "2009-01-09T00:00:00Z", "references": [{"url": "http://example.com/v0.1"}]},
+		{"title": "Hal Finney tweets Running bitcoin", "date": "2009-01-10T00:00:00Z"},
+		{"title": "Hal Finney tweets: Running bitcoin", "date": "2009-01-10T00:00:00Z"}
+	]`, &batch)
+	if status != http.StatusCreated || len(batch.Data) != 3 {
+		t.Fatalf("expected 201 with 3 items, got %d %+v", status, batch.Data)
+	}
+	if d := batch.Data[0].PossibleDuplicates; len(d) != 1 || d[0].ID != 2 || len(d[0].SharedReferences) != 1 {
+		t.Errorf("expected item 0 to share a reference with event 2, got %+v", d)
+	}
+	if d := batch.Data[1].PossibleDuplicates; d != nil {
+		t.Errorf("expected no warning for item 1, got %+v", d)
+	}
+	if d := batch.Data[2].PossibleDuplicates; len(d) != 1 || d[0].ID != batch.Data[1].ID {
+		t.Errorf("expected item 2 to duplicate item 1, got %+v", d)
+	}
+
+	// 3. The report groups the candidates, distant dates are not compared
+	var report struct {
+		Data       []DuplicateGroup `json:"data"`
+		Pagination PaginationData   `json:"pagination"`
+		Error      string           `json:"error"`
+	}
+	if status := api.do(http.MethodGet, "/api/admin/duplicates", "", &report); status != http.StatusOK || len(report.Data) != 3 || report.Pagination.Total != 3 {
+		t.Fatalf("expected 3 groups, got %d %+v", status, report)
+	}
+	if g := report.Data[0]; len(g.Events) != 2 || g.Events[0].ID != 1 || g.Events[1].ID != 5 || len(g.Pairs) != 1 {
+		t.Fatalf("expected events 1 and 5 to be grouped, got %+v", g)
+	}
+	if status := api.do(http.MethodGet, "/api/admin/duplicates?days=20", "", &report); status != http.StatusOK || len(report.Data[0].Events) != 3 {
+		t.Fatalf("expected a wider window to group event 4 as well, got %d %+v", status, report.Data)
+	}
+	for _, query := range []string{"days=-1", "days=x", "threshold=0", "threshold=1.5"} {
+		if status := api.do(http.MethodGet, "/api/admin/duplicates?"+query, "", &report); status != http.StatusBadRequest || report.Error == "" {
+			t.Errorf("%s: expected 400, got %d", query, status)
+		}
+	}
+
+	// 4. Merge keeps the union of tags and references and trashes the source
+	var merged struct {
+		Data     Event `json:"data"`
+		MergedID uint  `json:"merged_id"`
+		DryRun   bool  `json:"dry_run"`
+	}
+	if status := api.do(http.MethodPost, "/api/admin/duplicates/merge?dry_run=true", `{"target_id": 1, "source_id": 5}`, &merged); status != http.StatusOK || !merged.DryRun || len(merged.Data.Tags) != 2 {
+		t.Fatalf("expected a dry run preview, got %d %+v", status, merged)
+	}
+	var count int64
+	db.Model(&Event{}).Where("id = ?", 5).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected the dry run to keep event 5")
+	}
+	if status := api.do(http.MethodPost, "/api/admin/duplicates/merge", `{"target_id": 1, "source_id": 5}`, &merged); status != http.StatusOK || merged.MergedID != 5 {
+		t.Fatalf("expected 200 merging event 5, got %d %+v", status, merged)
+	}
+	if tags := merged.Data.Tags; len(tags) != 2 || tags[0] != "mining" || tags[1] != "genesis" {
+		t.Errorf("expected tags [mining genesis], got %v", tags)
+	}
+	if refs := merged.Data.References; len(refs) != 2 || refs[0].URL != "https://example.com/genesis" || refs[1].URL != "https://example.com/block-0" {
+		t.Errorf("expected the union of the references, got %+v", refs)
+	}
+	db.Model(&Event{}).Where("id = ?", 5).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected event 5 to be trashed")
+	}
+
+	// 5. Invalid merges
+	for body, want := range map[string]int{
+		`{"target_id": 1}`:                  http.StatusBadRequest,
+		`{"target_id": 1, "source_id": 1}`:  http.StatusBadRequest,
+		`{"target_id": 1, "source_id": 5}`:  http.StatusNotFound,
+		`{"target_id": 99, "source_id": 2}`: http.StatusNotFound,
+	} {
+		if status := api.do(http.MethodPost, "/api/admin/duplicates/merge", body, nil); status != want {
+			t.Errorf("%s: expected %d, got %d", body, want, status)
+		}
+	}
+}
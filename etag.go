@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// errEventModified is returned by conditional writes when the event changed
+// after it was loaded
+var errEventModified = errors.New("event was modified by another request")
+
+// eventETag is the entity tag of an event. It changes with every write, since
+// every write sets UpdatedAt.
+func eventETag(event *Event) string {
+	var version int64
+	if !event.UpdatedAt.IsZero() {
+		// Imported events may have no updated_at until their first write
+		version = event.UpdatedAt.UnixNano()
+	}
+	return fmt.Sprintf(`"%d-%x"`, event.ID, version)
+}
+
+// checkUnchanged returns errEventModified when the stored event no longer has
+// the ETag of the loaded one. It must run in the transaction of the write.
+func checkUnchanged(tx *gorm.DB, loaded *Event) error {
+	var current Event
+	if err := tx.First(&current, loaded.ID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errEventModified
+		}
+		return err
+	}
+	if eventETag(&current) != eventETag(loaded) {
+		return errEventModified
+	}
+	return nil
+}
+
+// ifMatchSatisfied reports whether the If-Match header of the request allows
+// writing the event. A missing header always does; otherwise the header must
+// be "*" or list the current ETag. Weak tags never match, as If-Match uses
+// strong comparison.
+func ifMatchSatisfied(c *fiber.Ctx, event *Event) bool {
+	header := strings.TrimSpace(c.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return true
+	}
+	current := eventETag(event)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == current {
+			return true
+		}
+	}
+	return false
+}
+
+// preconditionFailed writes the 412 response for a write whose If-Match does
+// not match, with the current ETag so the client can refetch and retry
+func preconditionFailed(c *fiber.Ctx, event *Event) error {
+	if event != nil {
+		c.Set(fiber.HeaderETag, eventETag(event))
+	}
+	return c.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{
+		"error": "Event has been modified since it was fetched, reload it and retry",
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventETags(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Get("/events/:id", getEventHandler)
+	api.Put("/events/:id", updateEventHandler)
+	api.Patch("/events/:id", patchEventHandler)
+	api.Delete("/events/:id", deleteEventHandler)
+
+	do := func(method, path, ifMatch, body string) (int, string) {
+		res := api.request(method, path, body, "If-Match", ifMatch)
+		return res.StatusCode, res.Header.Get("ETag")
+	}
+
+	event := Event{Title: "Genesis", Date: time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)}
+	if err := db.Create(&event).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+
+	// 1. GET returns the ETag, which a matching If-Match write accepts and replaces
+	status, etag := do(http.MethodGet, "/api/events/1", "", "")
+	if status != http.StatusOK || etag == "" {
+		t.Fatalf("expected 200 OK with an ETag, got %d %q", status, etag)
+	}
+	status, updated := do(http.MethodPatch, "/api/events/1", etag, `{"description": "First block"}`)
+	if status != http.StatusOK || updated == "" || updated == etag {
+		t.Fatalf("expected 200 OK with a new ETag, got %d %q", status, updated)
+	}
+	if _, current := do(http.MethodGet, "/api/events/1", "", ""); current != updated {
+		t.Fatalf("expected GET to return the ETag of the update %q, got %q", updated, current)
+	}
+
+	// 2. A stale or weak ETag is rejected, and the current one is returned
+	status, current := do(http.MethodPatch, "/api/events/1", etag, `{"description": "Overwritten"}`)
+	if status != http.StatusPreconditionFailed || current != updated {
+		t.Fatalf("expected 412 with the current ETag, got %d %q", status, current)
+	}
+	if status, _ := do(http.MethodPut, "/api/events/1", "W/"+updated, `{"title": "Genesis", "date": "2009-01-03T00:00:00Z"}`); status != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a weak ETag, got %d", status)
+	}
+	if status, _ := do(http.MethodDelete, "/api/events/1", etag, ""); status != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 when deleting with a stale ETag, got %d", status)
+	}
+	var stored Event
+	db.First(&stored, 1)
+	if stored.Description != "First block" {
+		t.Fatalf("expected rejected writes to leave the event unchanged, got %q", stored.Description)
+	}
+
+	// 3. A list containing the current ETag, "*" and no header all match
+	if status, _ := do(http.MethodPatch, "/api/events/1", `"1-0", `+updated, `{"description": "Block 0"}`); status != http.StatusOK {
+		t.Fatalf("expected 200 OK for a list with the current ETag, got %d", status)
+	}
+	if status, _ := do(http.MethodPatch, "/api/events/1", "*", `{"description": "Block zero"}`); status != http.StatusOK {
+		t.Fatalf("expected 200 OK for If-Match *, got %d", status)
+	}
+	_, etag = do(http.MethodGet, "/api/events/1", "", "")
+	if status, _ := do(http.MethodDelete, "/api/events/1", etag, ""); status != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", status)
+	}
+
+	// 4. Imported events without updated_at have an ETag too; rows changed after
+	// they were loaded are never overwritten
+	imported := Event{Title: "Pizza day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)}
+	db.Create(&imported)
+	db.Exec("UPDATE events SET updated_at = NULL WHERE id = ?", imported.ID)
+	if status, _ := do(http.MethodPatch, "/api/events/2", `"2-0"`, `{"description": "Imported without updated_at"}`); status != http.StatusOK {
+		t.Fatalf("expected 200 OK for an event without updated_at, got %d", status)
+	}
+	loaded := Event{Title: "Pizza day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)}
+	db.Create(&loaded)
+	db.Model(&Event{}).Where("id = ?", loaded.ID).Update("description", "Concurrent edit")
+	// The context is only used once the update succeeded
+	if err := updateEvent(nil, db, "en", &loaded, map[string]interface{}{"description": "Stale edit"}, auditUpdate); !errors.Is(err, errEventModified) {
+		t.Fatalf("expected errEventModified, got %v", err)
+	}
+}
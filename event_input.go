@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// MIME type of RFC 7396 JSON Merge Patch documents
+const mimeMergePatch = "application/merge-patch+json"
+
+// eventField describes a field of Event that clients may write
+type eventField struct {
+	target func(*Event) interface{} // Pointer to the field in an event
+	kind   string                   // Expected JSON value, for error messages
+}
+
+// writableEventFields is the allowlist of fields accepted by create, PUT and
+// PATCH, keyed by JSON name. The JSON names are also the column names.
+var writableEventFields = map[string]eventField{
+	"date":              {func(e *Event) interface{} { return &e.Date }, "an RFC 3339 timestamp, e.g. \"2009-01-03T00:00:00Z\""},
+	"title":             {func(e *Event) interface{} { return &e.Title }, "a string"},
+	"description":       {func(e *Event) interface{} { return &e.Description }, "a string"},
+	"tags":              {func(e *Event) interface{} { return &e.Tags }, "a JSON array of strings"},
+	"media":             {func(e *Event) interface{} { return &e.Media }, "a JSON array of strings"},
+	"references":        {func(e *Event) interface{} { return &e.References }, "a JSON array of references"},
+	"translation_group": {func(e *Event) interface{} { return &e.TranslationGroup }, "a string"},
+	"external_id":       {func(e *Event) interface{} { return &e.ExternalID }, "a string"},
+}
+
+// Event fields set by the server, rejected in request bodies
+var readOnlyEventFields = []string{"id", "created_at", "updated_at"}
+
+// eventInputError is a client error in an event request body
+type eventInputError struct {
+	message string
+}
+
+func (e *eventInputError) Error() string { return e.message }
+
+// decodeEventFields parses a request body into its top-level fields and checks
+// them against writableEventFields
+func decodeEventFields(body []byte) (map[string]json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return nil, &eventInputError{"Cannot parse JSON, expected an event object"}
+	}
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if slices.Contains(readOnlyEventFields, name) {
+			return nil, &eventInputError{fmt.Sprintf("Field '%s' is read-only", name)}
+		}
+		if _, ok := writableEventFields[name]; !ok {
+			return nil, &eventInputError{fmt.Sprintf("Unknown field '%s'", name)}
+		}
+	}
+	return fields, nil
+}
+
+// applyEventFields writes decoded fields onto event following RFC 7396: a
+// null value resets the field, arrays replace the whole list
+func applyEventFields(event *Event, fields map[string]json.RawMessage) error {
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		raw, field := fields[name], writableEventFields[name]
+		target := field.target(event)
+		if bytes.Equal(bytes.TrimSpace(raw), []byte("null")) {
+			v := reflect.ValueOf(target).Elem()
+			v.Set(reflect.Zero(v.Type()))
+			continue
+		}
+		if err := json.Unmarshal(raw, target); err != nil {
+			if isEventFieldError(err) {
+				return &eventInputError{err.Error()}
+			}
+			return &eventInputError{fmt.Sprintf("'%s' must be %s", name, field.kind)}
+		}
+	}
+	return nil
+}
+
+// validateEvent checks an event about to be created or written by an update
+func validateEvent(event *Event) error {
+	if strings.TrimSpace(event.Title) == "" || event.Date.IsZero() {
+		return &eventInputError{"Title and Date are required fields"}
+	}
+	if utf8.RuneCountInString(event.Title) > 255 {
+		return &eventInputError{"'title' must be at most 255 characters"}
+	}
+	if len(event.TranslationGroup) > 64 {
+		return &eventInputError{"'translation_group' must be at most 64 characters"}
+	}
+	if event.ExternalID != nil {
+		if strings.TrimSpace(*event.ExternalID) == "" {
+			return &eventInputError{"'external_id' must not be empty, use null to clear it"}
+		}
+		if utf8.RuneCountInString(*event.ExternalID) > 255 {
+			return &eventInputError{"'external_id' must be at most 255 characters"}
+		}
+	}
+	return nil
+}
+
+// parseEventInput applies a request body onto a copy of base and validates the
+// result. Create and PUT start from an empty event, PATCH from the stored one.
+func parseEventInput(body []byte, base Event) (Event, error) {
+	fields, err := decodeEventFields(body)
+	if err != nil {
+		return base, err
+	}
+	event := base
+	if err := applyEventFields(&event, fields); err != nil {
+		return base, err
+	}
+	// Only references sent by the client are checked, so a PATCH of another
+	// field does not fail on references stored before the rules existed
+	if _, ok := fields["references"]; ok {
+		if err := event.References.validate(); err != nil {
+			return base, &eventInputError{err.Error()}
+		}
+	}
+	return event, validateEvent(&event)
+}
+
+// eventUpdateData returns the writable fields of an event as an Updates map.
+// Every field is included, so zero values are written too.
+func eventUpdateData(event *Event) map[string]interface{} {
+	data := make(map[string]interface{}, len(writableEventFields))
+	for name, field := range writableEventFields {
+		data[name] = reflect.ValueOf(field.target(event)).Elem().Interface()
+	}
+	return data
+}
+
+// Handler for PATCH /api/events/{id}
+// Applies an RFC 7396 JSON Merge Patch to an event: fields present in the body
+// are replaced, fields set to null are cleared, other fields are kept.
+func patchEventHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	contentType := strings.ToLower(strings.TrimSpace(strings.Split(c.Get(fiber.HeaderContentType), ";")[0]))
+	if contentType != "" && contentType != fiber.MIMEApplicationJSON && contentType != mimeMergePatch {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"error": fmt.Sprintf("Content-Type must be %s or %s", mimeMergePatch, fiber.MIMEApplicationJSON),
+		})
+	}
+
+	event, err := findEvent(c, db, lang, "patchEventHandler")
+	if event == nil {
+		return err
+	}
+	patched, err := parseEventInput(c.Body(), *event)
+	if err != nil {
+		zlog.Warn().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("patchEventHandler: Invalid patch")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := updateEvent(c, db, lang, event, eventUpdateData(&patched), auditUpdate); err != nil {
+		var conflict *eventConflictError
+		if errors.As(err, &conflict) {
+			return c.Status(fiber.StatusConflict).JSON(conflict.response())
+		}
+		if errors.Is(err, errEventModified) {
+			return preconditionFailed(c, nil)
+		}
+		zlog.Error().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("patchEventHandler: Failed to update event")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update event"})
+	}
+	if !isDryRun(c) {
+		c.Set(fiber.HeaderETag, eventETag(event))
+	}
+	return c.JSON(withDryRun(c, fiber.Map{"data": event}))
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestEventWrites(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events", createEventHandler)
+	api.Put("/events/:id", updateEventHandler)
+	api.Patch("/events/:id", patchEventHandler)
+
+	do := func(method, path, contentType, body string) (int, Event, string) {
+		res := api.request(method, path, body, "Content-Type", contentType)
+		var decoded struct {
+			Data  Event  `json:"data"`
+			Error string `json:"error"`
+		}
+		json.NewDecoder(res.Body).Decode(&decoded)
+		return res.StatusCode, decoded.Data, decoded.Error
+	}
+
+	created := `{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "description": "First block", "tags": ["genesis", "mining"], "media": ["https://example.com/genesis.png"]}`
+	if status, _, msg := do(http.MethodPost, "/api/events", fiber.MIMEApplicationJSON, created); status != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d (%s)", status, msg)
+	}
+
+	// 1. PATCH replaces the given fields, clears null ones and keeps the rest
+	status, event, msg := do(http.MethodPatch, "/api/events/1", mimeMergePatch, `{"title": "Genesis block", "media": null}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d (%s)", status, msg)
+	}
+	if event.Title != "Genesis block" || len(event.Media) != 0 || event.Description != "First block" || len(event.Tags) != 2 {
+		t.Fatalf("unexpected patched event %+v", event)
+	}
+
+	// 2. PUT replaces the whole event; omitted fields are cleared
+	status, event, msg = do(http.MethodPut, "/api/events/1", fiber.MIMEApplicationJSON, `{"title": "Genesis block", "date": "2009-01-03T18:15:05Z", "tags": ["genesis"]}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d (%s)", status, msg)
+	}
+	if event.Description != "" || len(event.Tags) != 1 || event.Date.Hour() != 18 {
+		t.Fatalf("unexpected replaced event %+v", event)
+	}
+	if status, _, _ := do(http.MethodPut, "/api/events/1", fiber.MIMEApplicationJSON, `{"description": "No title"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a PUT without title and date, got %d", status)
+	}
+
+	// 3. Bodies are checked against the allowlist and validated like creations
+	rejected := []struct {
+		method, body, message string
+	}{
+		{http.MethodPatch, `{"id": 7}`, "Field 'id' is read-only"},
+		{http.MethodPatch, `{"created_at": "2020-01-01T00:00:00Z"}`, "Field 'created_at' is read-only"},
+		{http.MethodPatch, `{"rank": 1}`, "Unknown field 'rank'"},
+		{http.MethodPatch, `{"date": "yesterday"}`, "'date' must be an RFC 3339 timestamp, e.g. \"2009-01-03T00:00:00Z\""},
+		{http.MethodPatch, `{"title": null}`, "Title and Date are required fields"},
+		{http.MethodPatch, `{"title": 42}`, "'title' must be a string"},
+		{http.MethodPatch, `{"tags": "bitcoin"}`, errInvalidStringList.Error()},
+		{http.MethodPatch, `["title"]`, "Cannot parse JSON, expected an event object"},
+		{http.MethodPost, `{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "id": 1}`, "Field 'id' is read-only"},
+		{http.MethodPost, `{"title": "` + strings.Repeat("a", 256) + `", "date": "2009-01-03T00:00:00Z"}`, "'title' must be at most 255 characters"},
+	}
+	for _, tc := range rejected {
+		path := "/api/events/1"
+		if tc.method == http.MethodPost {
+			path = "/api/events"
+		}
+		status, _, msg := do(tc.method, path, fiber.MIMEApplicationJSON, tc.body)
+		if status != http.StatusBadRequest || msg != tc.message {
+			t.Errorf("%s %s: expected 400 %q, got %d %q", tc.method, tc.body, tc.message, status, msg)
+		}
+	}
+	var stored Event
+	db.First(&stored, 1)
+	if stored.Title != "Genesis block" || stored.Date.Hour() != 18 {
+		t.Fatalf("expected rejected patches to leave the event unchanged, got %+v", stored)
+	}
+
+	// 4. PATCH only accepts JSON bodies
+	if status, _, _ := do(http.MethodPatch, "/api/events/1", "text/plain", `{"title": "x"}`); status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415 for a text body, got %d", status)
+	}
+	if status, _, _ := do(http.MethodPatch, "/api/events/9", mimeMergePatch, `{"title": "x"}`); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing event, got %d", status)
+	}
+
+	// 5. References are validated when sent, but stored ones do not block other writes
+	if status, _, msg := do(http.MethodPost, "/api/events", fiber.MIMEApplicationJSON, `{"title": "Bad", "date": "2009-01-03T00:00:00Z", "references": ["not a url"]}`); status != http.StatusBadRequest || !strings.HasPrefix(msg, errInvalidReferences.Error()) {
+		t.Fatalf("expected 400 for an invalid reference, got %d %q", status, msg)
+	}
+	db.Exec(`UPDATE events SET "references" = ? WHERE id = 1`, `[{"url": ""}]`)
+	if status, _, msg := do(http.MethodPatch, "/api/events/1", mimeMergePatch, `{"title": "Genesis"}`); status != http.StatusOK {
+		t.Fatalf("expected 200 for a PATCH next to a stored invalid reference, got %d (%s)", status, msg)
+	}
+	if status, _, _ := do(http.MethodPatch, "/api/events/1", mimeMergePatch, `{"references": [{"url": ""}]}`); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for a patched invalid reference, got %d", status)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestGetEventsByDateRejectsMalformedDate(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/events/date/:date", getEventsByDateHandler)
+
+	for _, date := range []string{"13-01", "02-30", "2024-1-5", "yesterday"} {
+		req, _ := http.NewRequest(http.MethodGet, "/api/events/date/"+date, nil)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		if res.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400 Bad Request, got %d", date, res.StatusCode)
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatalf("%s: failed to decode response: %v", date, err)
+		}
+		if body["error"] != "Invalid date format" || body["date"] != date {
+			t.Fatalf("%s: unexpected error body %v", date, body)
+		}
+	}
+}
+
+func TestGetEventsByDate(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	for _, e := range []Event{
+		{Title: "Genesis block", Date: time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{Title: "Bitcoin Core 0.19 tagged", Date: time.Date(2019, 1, 3, 18, 30, 0, 0, time.UTC)},
+		{Title: "Ten years of Bitcoin", Date: time.Date(2019, 1, 3, 9, 0, 0, 0, time.UTC)},
+		{Title: "Tenth block reward halving day", Date: time.Date(2019, 1, 4, 0, 0, 0, 0, time.UTC)},
+		{Title: "Bitcoin Pizza Day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)},
+		{Title: "January 3rd celebration", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	api.Get("/events/date/:date", getEventsByDateHandler)
+
+	tests := []struct {
+		path string
+		ids  []uint
+	}{
+		// MM-DD matches the day in every year, newest first by default
+		{"/api/events/date/01-03", []uint{6, 2, 3, 1}},
+		{"/api/events/date/01-03?sort=asc", []uint{1, 3, 2, 6}},
+		// YYYY-MM-DD matches a single day, whatever the time of day
+		{"/api/events/date/2019-01-03?sort=asc", []uint{3, 2}},
+		{"/api/events/date/2010-05-22", []uint{5}},
+		{"/api/events/date/2011-05-22", []uint{}},
+		{"/api/events/date/01-03?limit=2&page=2", []uint{3, 1}},
+	}
+	for _, tt := range tests {
+		var body struct {
+			Events     []Event        `json:"events"`
+			Pagination PaginationData `json:"pagination"`
+		}
+		if status := api.do(http.MethodGet, tt.path, "", &body); status != http.StatusOK {
+			t.Fatalf("%s: expected 200 OK, got %d", tt.path, status)
+		}
+		ids := []uint{}
+		for _, e := range body.Events {
+			ids = append(ids, e.ID)
+		}
+		if !slices.Equal(ids, tt.ids) {
+			t.Errorf("%s: expected events %v, got %v", tt.path, tt.ids, ids)
+		}
+	}
+}
+
+func TestGetEventsByMonth(t *testing.T) {
+	// Days are keyed in UTC like the SQL summary, whatever the host's time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	api := newTestAPI(t)
+	db := api.db
+	for _, e := range []Event{
+		{Title: "Genesis block", Date: time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{Title: "Ten years of Bitcoin", Date: time.Date(2019, 1, 3, 2, 0, 0, 0, time.UTC)},
+		{Title: "Bitcoin v0.1 released", Date: time.Date(2009, 1, 9, 0, 0, 0, 0, time.UTC)},
+		{Title: "New year", Date: time.Date(2019, 1, 1, 1, 0, 0, 0, time.UTC)},
+		{Title: "Bitcoin Pizza Day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	api.Get("/events/month/:month", getEventsByMonthHandler)
+
+	get := func(path string) MonthEventsResponse {
+		var body MonthEventsResponse
+		if status := api.do(http.MethodGet, path, "", &body); status != http.StatusOK {
+			t.Fatalf("%s: expected 200 OK, got %d", path, status)
+		}
+		return body
+	}
+	dayIDs := func(days []DayEvents) map[string][]uint {
+		ids := map[string][]uint{}
+		for _, day := range days {
+			for _, e := range day.Events {
+				ids[day.Date] = append(ids[day.Date], e.ID)
+			}
+		}
+		return ids
+	}
+
+	// 1. MM groups the events of every year by MM-DD
+	body := get("/api/events/month/01?sort=asc")
+	wantSummary := []DayCount{{"01-01", 1}, {"01-03", 2}, {"01-09", 1}}
+	if !slices.Equal(body.Summary, wantSummary) || body.Pagination.Total != 4 {
+		t.Fatalf("expected summary %v with 4 events, got %v %+v", wantSummary, body.Summary, body.Pagination)
+	}
+	if got := dayIDs(body.Days); len(body.Days) != 3 || !slices.Equal(got["01-01"], []uint{4}) || !slices.Equal(got["01-03"], []uint{1, 2}) || !slices.Equal(got["01-09"], []uint{3}) {
+		t.Fatalf("expected the events grouped by day, got %v", got)
+	}
+
+	// 2. YYYY-MM groups one calendar month by YYYY-MM-DD
+	body = get("/api/events/month/2019-01")
+	if got := dayIDs(body.Days); body.Pagination.Total != 2 || len(body.Days) != 2 || body.Days[0].Date != "2019-01-03" || !slices.Equal(got["2019-01-01"], []uint{4}) {
+		t.Fatalf("expected the two days of January 2019, newest first, got %+v", body.Days)
+	}
+
+	// 3. Pages cut across days, the summary still covers the whole month
+	body = get("/api/events/month/01?sort=asc&limit=2&page=2")
+	if got := dayIDs(body.Days); len(body.Summary) != 3 || !slices.Equal(got["01-03"], []uint{2}) || !slices.Equal(got["01-09"], []uint{3}) {
+		t.Fatalf("expected the second page to hold events 2 and 3, got %v", got)
+	}
+}
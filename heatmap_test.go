@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGetHeatmap(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	if err := initTagTables(db); err != nil {
+		t.Fatalf("failed to init tag tables: %v", err)
+	}
+	for _, e := range []Event{
+		{Title: "Genesis block", Date: time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC), Tags: StringList{"mining"}},
+		{Title: "Ten years of Bitcoin", Date: time.Date(2019, 1, 3, 18, 0, 0, 0, time.UTC)},
+		{Title: "Bitcoin v0.1 released", Date: time.Date(2009, 1, 9, 0, 0, 0, 0, time.UTC)},
+		{Title: "First difficulty adjustment", Date: time.Date(2009, 12, 30, 0, 0, 0, 0, time.UTC), Tags: StringList{"Mining"}},
+		{Title: "Bitcoin Pizza Day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)},
+	} {
+		if err := db.Create(&e).Error; err != nil {
+			t.Fatalf("failed to create event: %v", err)
+		}
+	}
+
+	api.Get("/heatmap", getHeatmapHandler)
+
+	type heatmap struct {
+		Granularity string     `json:"granularity"`
+		Total       int64      `json:"total"`
+		Data        []DayCount `json:"data"`
+	}
+	tests := []struct {
+		query string
+		want  heatmap
+	}{
+		// Without a year, days of every year are counted together
+		{"", heatmap{"day_of_year", 5, []DayCount{{"01-03", 2}, {"01-09", 1}, {"05-22", 1}, {"12-30", 1}}}},
+		{"?month=1", heatmap{"day_of_year", 3, []DayCount{{"01-03", 2}, {"01-09", 1}}}},
+		// With a year, days are calendar dates
+		{"?year=2009", heatmap{"date", 3, []DayCount{{"2009-01-03", 1}, {"2009-01-09", 1}, {"2009-12-30", 1}}}},
+		{"?year=2009&month=01", heatmap{"date", 2, []DayCount{{"2009-01-03", 1}, {"2009-01-09", 1}}}},
+		{"?tag=mining", heatmap{"day_of_year", 2, []DayCount{{"01-03", 1}, {"12-30", 1}}}},
+		{"?year=2011", heatmap{"date", 0, []DayCount{}}},
+	}
+	for _, tt := range tests {
+		var got heatmap
+		if status := api.do(http.MethodGet, "/api/heatmap"+tt.query, "", &got); status != http.StatusOK {
+			t.Fatalf("%q: expected 200 OK, got %d", tt.query, status)
+		}
+		if got.Granularity != tt.want.Granularity || got.Total != tt.want.Total || !slices.Equal(got.Data, tt.want.Data) {
+			t.Errorf("%q: expected %+v, got %+v", tt.query, tt.want, got)
+		}
+	}
+
+	for _, query := range []string{"?year=09", "?month=13"} {
+		if status := api.do(http.MethodGet, "/api/heatmap"+query, "", nil); status != http.StatusBadRequest {
+			t.Errorf("%q: expected 400 Bad Request, got %d", query, status)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB creates an events table without the FTS5 parts of InitDB,
+// which need the fts5 build tag.
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "events.db")), &gorm.Config{
+		Logger:  logger.Default.LogMode(logger.Silent),
+		NowFunc: nowUTC,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&Event{}, &EventRevision{}); err != nil {
+		t.Fatalf("failed to migrate events: %v", err)
+	}
+	return db
+}
+
+// testAPI is an app whose /api group serves the handlers under test from test
+// databases registered in languageDBs. Routes are added through the embedded group.
+type testAPI struct {
+	fiber.Router // The /api group
+
+	t   *testing.T
+	app *fiber.App
+	db  *gorm.DB // The "en" database
+}
+
+// newTestAPI registers a test database for "en" and mounts the /api group
+// behind the given middleware and languageMiddleware. languageDBs is reset
+// when the test ends.
+func newTestAPI(t *testing.T, middleware ...fiber.Handler) *testAPI {
+	db := openTestDB(t)
+	languageDBs = map[string]*gorm.DB{"en": db}
+	t.Cleanup(func() { languageDBs = map[string]*gorm.DB{} })
+
+	app := fiber.New()
+	handlers := append(middleware, languageMiddleware)
+	return &testAPI{Router: app.Group("/api", handlers...), t: t, app: app, db: db}
+}
+
+// addLanguage registers a test database for another language and returns it
+func (a *testAPI) addLanguage(lang string) *gorm.DB {
+	db := openTestDB(a.t)
+	languageDBs[lang] = db
+	return db
+}
+
+// request sends a JSON request with extra headers given as name/value pairs.
+// Headers with an empty value are left out.
+func (a *testAPI) request(method, path, body string, headers ...string) *http.Response {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for i := 0; i+1 < len(headers); i += 2 {
+		if headers[i+1] != "" {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+	}
+	res, err := a.app.Test(req)
+	if err != nil {
+		a.t.Fatalf("failed to perform request: %v", err)
+	}
+	return res
+}
+
+// do sends a request like request, decodes the response into out unless it
+// is nil, and returns the status code
+func (a *testAPI) do(method, path, body string, out interface{}, headers ...string) int {
+	res := a.request(method, path, body, headers...)
+	if out != nil {
+		if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+			a.t.Fatalf("failed to decode %s %s: %v", method, path, err)
+		}
+	}
+	return res.StatusCode
+}
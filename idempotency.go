@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Request header naming a retryable POST, and the response header marking a replay
+const (
+	headerIdempotencyKey = "Idempotency-Key"
+	headerReplayed       = "Idempotent-Replayed"
+)
+
+// idempotencyTTL is how long a stored response is replayed, set by IDEMPOTENCY_KEY_TTL
+var idempotencyTTL = 24 * time.Hour
+
+// idempotencyLease is how long a key is held for a request that has not
+// answered yet, set by IDEMPOTENCY_KEY_LEASE. A retry after that runs the
+// request again, so a key whose request died is not blocked until it expires.
+var idempotencyLease = time.Minute
+
+// How often expired keys are deleted
+const idempotencyCleanupInterval = 10 * time.Minute
+
+// IdempotencyRecord is a row of the idempotency_keys table, stored in the
+// system database. It holds the response to the first request sent with a
+// key, replayed to retries of that request until it expires.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey"`
+	Owner       string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_owner_key,priority:1"` // The API key that sent the request
+	Key         string    `gorm:"size:255;not null;uniqueIndex:idx_idempotency_keys_owner_key,priority:2"`
+	Fingerprint string    `gorm:"size:64;not null"`   // SHA-256 of the method, path, query, language and body
+	Status      int       `gorm:"not null;default:0"` // 0 while the first request is being processed
+	ContentType string    `gorm:"size:255"`
+	Body        []byte    `gorm:"type:blob"`
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index:idx_idempotency_keys_expires_at"`
+}
+
+// TableName names the table after the keys it stores
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
+
+// loadIdempotencyConfig reads IDEMPOTENCY_KEY_TTL and IDEMPOTENCY_KEY_LEASE
+func loadIdempotencyConfig() error {
+	for _, setting := range []struct {
+		name    string
+		value   *time.Duration
+		example string
+	}{
+		{"IDEMPOTENCY_KEY_TTL", &idempotencyTTL, "24h"},
+		{"IDEMPOTENCY_KEY_LEASE", &idempotencyLease, "1m"},
+	} {
+		if v := os.Getenv(setting.name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				return fmt.Errorf("%s must be a positive duration such as %s, got %q", setting.name, setting.example, v)
+			}
+			*setting.value = d
+		}
+	}
+	return nil
+}
+
+// cleanUpIdempotencyKeys deletes expired keys from db every interval, for the
+// life of the process
+func cleanUpIdempotencyKeys(db *gorm.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		result := db.Where("expires_at <= ?", time.Now().UTC()).Delete(&IdempotencyRecord{})
+		if result.Error != nil {
+			zlog.Error().Err(result.Error).Msg("cleanUpIdempotencyKeys: Failed to delete expired keys")
+		} else if result.RowsAffected > 0 {
+			zlog.Info().Int64("deleted", result.RowsAffected).Msg("cleanUpIdempotencyKeys: Expired keys deleted")
+		}
+	}
+}
+
+// requestFingerprint identifies what a request asks for, so a key reused for
+// a different request can be told apart from a retry
+func requestFingerprint(c *fiber.Ctx) string {
+	lang, _ := requestLanguage(c)
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(c.Method()), []byte(c.Path()), c.Request().URI().QueryString(), []byte(lang), c.Body()} {
+		h.Write(part)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotencyMiddleware makes POST endpoints safe to retry. The first request
+// with an Idempotency-Key header runs normally and its response is stored;
+// retries with the same key and request get that response back, with
+// Idempotent-Replayed: true, without running the handler again. Reusing a key
+// for a different request is rejected. Server errors are not stored, so the
+// request can be retried, and so can a request that has held its key for longer
+// than idempotencyLease without answering. It must run after authMiddleware and
+// languageMiddleware.
+func idempotencyMiddleware(c *fiber.Ctx) error {
+	key := strings.TrimSpace(c.Get(headerIdempotencyKey))
+	if key == "" || systemDB == nil {
+		return c.Next()
+	}
+	if len(key) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Idempotency-Key must be at most 255 characters"})
+	}
+	owner := ""
+	if apiKey := requestAPIKey(c); apiKey != nil {
+		owner = apiKey.limiterIdentity()
+	}
+
+	now := time.Now().UTC()
+	record := IdempotencyRecord{
+		Owner:       owner,
+		Key:         key,
+		Fingerprint: requestFingerprint(c),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(idempotencyTTL),
+	}
+	if err := systemDB.Create(&record).Error; err != nil {
+		// The key is taken: this is a retry, a concurrent request or a reuse
+		var stored IdempotencyRecord
+		if err := systemDB.Where("owner = ? AND key = ?", owner, key).First(&stored).Error; err != nil {
+			zlog.Error().Str("owner", owner).Err(err).Msg("idempotencyMiddleware: Failed to load key")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check Idempotency-Key"})
+		}
+		// Expired keys are deleted periodically, until then they are free to take
+		if now.Before(stored.ExpiresAt) {
+			if stored.Fingerprint != record.Fingerprint {
+				return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"error": "Idempotency-Key was already used for a different request"})
+			}
+			if stored.Status != 0 {
+				zlog.Info().Str("owner", owner).Str("path", c.Path()).Msg("idempotencyMiddleware: Replaying stored response")
+				c.Set(headerReplayed, "true")
+				c.Set(fiber.HeaderContentType, stored.ContentType)
+				return c.Status(stored.Status).Send(stored.Body)
+			}
+			if now.Before(stored.CreatedAt.Add(idempotencyLease)) {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still being processed"})
+			}
+		}
+
+		// Take the key over. created_at identifies the lease: a concurrent retry
+		// that took the key first has changed it, and a request that lost its
+		// lease cannot store its response.
+		result := systemDB.Model(&IdempotencyRecord{}).Where("id = ? AND created_at = ?", stored.ID, stored.CreatedAt).Updates(map[string]interface{}{
+			"fingerprint":  record.Fingerprint,
+			"status":       0,
+			"content_type": "",
+			"body":         nil,
+			"created_at":   record.CreatedAt,
+			"expires_at":   record.ExpiresAt,
+		})
+		if result.Error != nil {
+			zlog.Error().Str("owner", owner).Err(result.Error).Msg("idempotencyMiddleware: Failed to take over key")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to check Idempotency-Key"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "A request with this Idempotency-Key is still being processed"})
+		}
+		record.ID = stored.ID
+		zlog.Info().Str("owner", owner).Str("path", c.Path()).Msg("idempotencyMiddleware: Took over expired or abandoned key")
+	}
+
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if err != nil || status >= fiber.StatusInternalServerError {
+		// Server errors are not final, let a retry run the request again
+		if err := systemDB.Where("created_at = ?", record.CreatedAt).Delete(&record).Error; err != nil {
+			zlog.Error().Str("owner", owner).Err(err).Msg("idempotencyMiddleware: Failed to release key")
+		}
+		return err
+	}
+	if err := systemDB.Model(&record).Where("created_at = ?", record.CreatedAt).Updates(map[string]interface{}{
+		"status":       status,
+		"content_type": string(c.Response().Header.ContentType()),
+		"body":         c.Response().Body(),
+	}).Error; err != nil {
+		zlog.Error().Str("owner", owner).Err(err).Msg("idempotencyMiddleware: Failed to store response")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeys(t *testing.T) {
+	var err error
+	systemDB, err = InitSystemDB(filepath.Join(t.TempDir(), "system.db"))
+	if err != nil {
+		t.Fatalf("InitSystemDB failed: %v", err)
+	}
+	validAPIKeys, _ = parseAPIKeys("ingest=events:write,other=events:write")
+	defer func() { systemDB, validAPIKeys = nil, nil }()
+
+	api := newTestAPI(t, authMiddleware)
+	db := api.db
+	write := requireScope(scopeEventsWrite)
+	api.Post("/events", write, idempotencyMiddleware, createEventHandler)
+	api.Post("/events/batch", write, idempotencyMiddleware, batchCreateEventsHandler)
+
+	do := func(apiKey, path, idempotencyKey, body string) (int, string, bool) {
+		res := api.request(http.MethodPost, path, body, "X-API-KEY", apiKey, "Idempotency-Key", idempotencyKey)
+		b, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(b), res.Header.Get("Idempotent-Replayed") == "true"
+	}
+	countEvents := func() int64 {
+		var count int64
+		db.Model(&Event{}).Count(&count)
+		return count
+	}
+	genesis := `{"title": "Genesis", "date": "2009-01-03T00:00:00Z"}`
+
+	// 1. A retry with the same key replays the original response
+	status, first, replayed := do("ingest", "/api/events", "import-1", genesis)
+	if status != http.StatusCreated || replayed {
+		t.Fatalf("expected 201 Created, got %d", status)
+	}
+	status, retry, replayed := do("ingest", "/api/events", "import-1", genesis)
+	if status != http.StatusCreated || !replayed || retry != first {
+		t.Fatalf("expected the original 201 to be replayed, got %d %v %s", status, replayed, retry)
+	}
+	if count := countEvents(); count != 1 {
+		t.Fatalf("expected the retry not to create an event, got %d events", count)
+	}
+
+	// 2. Reusing the key for a different request is rejected
+	if status, _, _ := do("ingest", "/api/events", "import-1", `{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"}`); status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a different body, got %d", status)
+	}
+	if status, _, _ := do("ingest", "/api/events?upsert=true", "import-1", genesis); status != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a different query, got %d", status)
+	}
+
+	// 3. Keys are scoped to the API key, and client errors are replayed too
+	if status, _, replayed := do("other", "/api/events", "import-1", genesis); status != http.StatusCreated || replayed {
+		t.Fatalf("expected another API key to have its own keys, got %d", status)
+	}
+	do("ingest", "/api/events", "import-2", `{"title": "No date"}`)
+	if status, _, replayed := do("ingest", "/api/events", "import-2", `{"title": "No date"}`); status != http.StatusBadRequest || !replayed {
+		t.Fatalf("expected the 400 to be replayed, got %d %v", status, replayed)
+	}
+
+	// 4. Batches are covered as well
+	batch := `[{"title": "Mt. Gox", "date": "2014-02-24T00:00:00Z"}, {"title": "Halving", "date": "2012-11-28T00:00:00Z"}]`
+	do("ingest", "/api/events/batch", "batch-1", batch)
+	if status, _, replayed := do("ingest", "/api/events/batch", "batch-1", batch); status != http.StatusCreated || !replayed {
+		t.Fatalf("expected the batch response to be replayed, got %d %v", status, replayed)
+	}
+	if count := countEvents(); count != 4 {
+		t.Fatalf("expected 4 events, got %d", count)
+	}
+
+	// 5. Expired keys run the request again
+	systemDB.Model(&IdempotencyRecord{}).Where("key = ?", "import-1").Update("expires_at", time.Now().Add(-time.Minute))
+	if status, _, replayed := do("ingest", "/api/events", "import-1", genesis); status != http.StatusCreated || replayed {
+		t.Fatalf("expected an expired key to be usable again, got %d %v", status, replayed)
+	}
+	if count := countEvents(); count != 5 {
+		t.Fatalf("expected 5 events, got %d", count)
+	}
+	if status, _, replayed := do("ingest", "/api/events", "import-1", genesis); status != http.StatusCreated || !replayed {
+		t.Fatalf("expected the new response to be replayed, got %d %v", status, replayed)
+	}
+
+	// 6. A key is held for a request that has not answered, until its lease runs out
+	pizza := `{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"}`
+	pending := IdempotencyRecord{Owner: "static:" + staticAPIKeyName("ingest"), Key: "import-3", CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour)}
+	do("ingest", "/api/events", "import-3", pizza)
+	systemDB.Model(&IdempotencyRecord{}).Where("key = ?", "import-3").Select("status", "created_at").Updates(&pending)
+	if status, _, _ := do("ingest", "/api/events", "import-3", pizza); status != http.StatusConflict {
+		t.Fatalf("expected 409 while the first request holds the key, got %d", status)
+	}
+	systemDB.Model(&IdempotencyRecord{}).Where("key = ?", "import-3").Update("created_at", time.Now().UTC().Add(-idempotencyLease))
+	if status, _, replayed := do("ingest", "/api/events", "import-3", pizza); status != http.StatusCreated || replayed {
+		t.Fatalf("expected a retry to take over an abandoned key, got %d %v", status, replayed)
+	}
+	if status, _, replayed := do("ingest", "/api/events", "import-3", pizza); status != http.StatusCreated || !replayed {
+		t.Fatalf("expected the retry's response to be replayed, got %d %v", status, replayed)
+	}
+}
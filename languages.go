@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// languageDBs is the registry of supported languages, keyed by lowercase language
+// code (e.g. "en", "ru"). Every language has its own SQLite database.
+var languageDBs = map[string]*gorm.DB{}
+
+// defaultLanguage is served when a request does not ask for a language
+var defaultLanguage = "en"
+
+// Language codes must look like "en", "pt" or "pt-br"
+var languageCodePattern = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// Keys under which languageMiddleware stores the resolved language in c.Locals
+const (
+	localsLang = "lang"
+	localsDB   = "db"
+)
+
+// availableLanguages returns the registered language codes in alphabetical order
+func availableLanguages() []string {
+	langs := make([]string, 0, len(languageDBs))
+	for lang := range languageDBs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// defaultDBPath returns the database path used when DB_PATH_<LANG> is not set.
+// English keeps its historical events.db name, other languages use events_<lang>.db.
+func defaultDBPath(lang string) string {
+	if lang == "en" {
+		return "./data/events.db"
+	}
+	return "./data/events_" + lang + ".db"
+}
+
+// loadLanguageConfig reads the configured languages and their database paths.
+// Languages are taken from the comma-separated LANGUAGES variable (defaults to
+// "en,ru") and from every DB_PATH_<LANG> variable, so adding a language only
+// requires pointing DB_PATH_<LANG> at its database.
+func loadLanguageConfig(environ []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	langsStr := env["LANGUAGES"]
+	if strings.TrimSpace(langsStr) == "" {
+		langsStr = "en,ru"
+	}
+	var langs []string
+	for _, l := range strings.Split(langsStr, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			langs = append(langs, l)
+		}
+	}
+	for k := range env {
+		if l, ok := strings.CutPrefix(k, "DB_PATH_"); ok && l != "" {
+			langs = append(langs, l)
+		}
+	}
+
+	paths := map[string]string{}
+	for _, l := range langs {
+		// Environment variables use "PT_BR", language codes use "pt-br"
+		lang := strings.ReplaceAll(strings.ToLower(l), "_", "-")
+		if !languageCodePattern.MatchString(lang) {
+			return nil, fmt.Errorf("invalid language code %q", l)
+		}
+		path := env["DB_PATH_"+strings.ReplaceAll(strings.ToUpper(lang), "-", "_")]
+		if path == "" {
+			path = defaultDBPath(lang)
+		}
+		paths[lang] = path
+	}
+	return paths, nil
+}
+
+// initLanguageDBs opens the database of every configured language and fills the registry
+func initLanguageDBs() error {
+	paths, err := loadLanguageConfig(os.Environ())
+	if err != nil {
+		return err
+	}
+
+	if v := strings.TrimSpace(os.Getenv("DEFAULT_LANGUAGE")); v != "" {
+		defaultLanguage = strings.ToLower(v)
+	}
+	if _, ok := paths[defaultLanguage]; !ok {
+		return fmt.Errorf("default language %q is not configured", defaultLanguage)
+	}
+
+	for lang, path := range paths {
+		db, err := InitDB(path)
+		if err != nil {
+			return fmt.Errorf("failed to initialize %s database at %s: %w", lang, path, err)
+		}
+		languageDBs[lang] = db
+		zlog.Info().Str("lang", lang).Str("db_path", path).Msg("Language database initialized")
+	}
+	return nil
+}
+
+// negotiateLanguage picks the best registered language for an Accept-Language
+// header. Ranges are tried by descending quality; a range matches a language
+// exactly or through its primary subtag ("ru-RU" matches "ru"), and "*" matches
+// the default language. The second return value is false when nothing matched.
+func negotiateLanguage(header string) (string, bool) {
+	type languageRange struct {
+		tag     string
+		quality float64
+	}
+
+	var ranges []languageRange
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		quality := 1.0
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			v, err := strconv.ParseFloat(q, 64)
+			if err != nil {
+				continue
+			}
+			quality = v
+		}
+		if quality <= 0 {
+			continue
+		}
+		ranges = append(ranges, languageRange{tag: tag, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].quality > ranges[j].quality })
+
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return defaultLanguage, true
+		}
+		if _, ok := languageDBs[r.tag]; ok {
+			return r.tag, true
+		}
+		if primary, _, ok := strings.Cut(r.tag, "-"); ok {
+			if _, ok := languageDBs[primary]; ok {
+				return primary, true
+			}
+		}
+	}
+	return defaultLanguage, false
+}
+
+// languageMiddleware resolves the requested language against the registry and
+// stores the language and its database in c.Locals for the handlers. The lang
+// query parameter wins; without it the language is negotiated from the
+// Accept-Language header. Unknown lang values are rejected instead of silently
+// falling back to the default. The served language is reported in Content-Language.
+func languageMiddleware(c *fiber.Ctx) error {
+	c.Vary(fiber.HeaderAcceptLanguage)
+
+	lang := strings.ToLower(c.Query("lang"))
+	if lang == "" {
+		lang, _ = negotiateLanguage(c.Get(fiber.HeaderAcceptLanguage))
+	}
+	db, ok := languageDBs[lang]
+	if !ok {
+		zlog.Warn().Str("lang", lang).Msg("languageMiddleware: Unsupported language")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":               fmt.Sprintf("Unsupported language '%s'", lang),
+			"available_languages": availableLanguages(),
+		})
+	}
+
+	c.Locals(localsLang, lang)
+	c.Locals(localsDB, db)
+	c.Set(fiber.HeaderContentLanguage, lang)
+	return c.Next()
+}
+
+// requestLanguage returns the language and database resolved by languageMiddleware
+func requestLanguage(c *fiber.Ctx) (string, *gorm.DB) {
+	lang, _ := c.Locals(localsLang).(string)
+	db, _ := c.Locals(localsDB).(*gorm.DB)
+	return lang, db
+}
+
+// fallbackRequested reports whether the client opted into falling back to the
+// default language for events missing in the requested one (?fallback=true)
+func fallbackRequested(c *fiber.Ctx, lang string) bool {
+	return c.QueryBool("fallback") && lang != defaultLanguage
+}
+
+// withMissingTranslations runs fn on a connection of the default language
+// database to which db is attached, with a scope selecting the default language
+// events whose translation group has no event in db. Events are matched across
+// languages through their translation group only, as IDs are per language, so
+// events without a group are never selected. The groups are compared by SQLite,
+// so the queries do not grow with the number of groups.
+func withMissingTranslations(db *gorm.DB, fn func(defaultDB *gorm.DB, missing func(*gorm.DB) *gorm.DB) error) error {
+	path, err := databaseFile(db)
+	if err != nil {
+		return err
+	}
+	missing := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(`translation_group <> '' AND NOT EXISTS (
+			SELECT 1 FROM translated.events t
+			WHERE t.translation_group = events.translation_group AND t.deleted_at IS NULL)`)
+	}
+	// ATTACH applies to a single connection, so every query must run on it
+	return languageDBs[defaultLanguage].Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("ATTACH DATABASE ? AS translated", path).Error; err != nil {
+			return err
+		}
+		err := fn(conn, missing)
+		if detachErr := conn.Exec("DETACH DATABASE translated").Error; err == nil {
+			err = detachErr
+		}
+		return err
+	})
+}
+
+// databaseFile returns the path of the file of an SQLite database
+func databaseFile(db *gorm.DB) (string, error) {
+	var databases []struct {
+		Name string
+		File string
+	}
+	if err := db.Raw("PRAGMA database_list").Scan(&databases).Error; err != nil {
+		return "", err
+	}
+	for _, d := range databases {
+		if d.Name == "main" && d.File != "" {
+			return d.File, nil
+		}
+	}
+	return "", fmt.Errorf("database has no file to attach")
+}
+
+// eventList describes a paginated list endpoint: which events it selects and
+// in which order
+type eventList struct {
+	filter func(*gorm.DB) *gorm.DB // Where clauses selecting the events
+	order  string                  // SQL ORDER BY clause
+	before func(a, b *Event) bool  // The same order in Go, to merge fallback events in
+}
+
+// byDate orders events by date, "date asc" or "date desc" as returned by parseSortOrder
+func byDate(order string) func(a, b *Event) bool {
+	if order == "date asc" {
+		return func(a, b *Event) bool { return a.Date.Before(b.Date) }
+	}
+	return func(a, b *Event) bool { return a.Date.After(b.Date) }
+}
+
+// find counts the events of the list and loads one page of them. With
+// ?fallback=true, the default language events missing in lang are part of the
+// list too, marked as fallbacks.
+func (l eventList) find(c *fiber.Ctx, lang string, db *gorm.DB, limit, offset int) ([]Event, int64, error) {
+	var total int64
+	if err := db.Model(&Event{}).Scopes(l.filter).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []Event
+	if !fallbackRequested(c, lang) {
+		err := db.Scopes(l.filter).Order(l.order).Limit(limit).Offset(offset).Find(&events).Error
+		return events, total, err
+	}
+
+	// The page lies within the first offset+limit events of both lists
+	if err := db.Scopes(l.filter).Order(l.order).Limit(offset + limit).Find(&events).Error; err != nil {
+		return nil, 0, err
+	}
+	var fallbacks []Event
+	var fallbackTotal int64
+	err := withMissingTranslations(db, func(defaultDB *gorm.DB, missing func(*gorm.DB) *gorm.DB) error {
+		if err := defaultDB.Model(&Event{}).Scopes(l.filter, missing).Count(&fallbackTotal).Error; err != nil {
+			return err
+		}
+		return defaultDB.Scopes(l.filter, missing).Order(l.order).Limit(offset + limit).Find(&fallbacks).Error
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	merged := make([]Event, 0, len(events)+len(fallbacks))
+	for len(events) > 0 || len(fallbacks) > 0 {
+		if len(fallbacks) == 0 || (len(events) > 0 && !l.before(&fallbacks[0], &events[0])) {
+			merged, events = append(merged, events[0]), events[1:]
+			continue
+		}
+		fallbacks[0].Fallback = true
+		merged, fallbacks = append(merged, fallbacks[0]), fallbacks[1:]
+	}
+	return merged[min(offset, len(merged)):min(offset+limit, len(merged))], total + fallbackTotal, nil
+}
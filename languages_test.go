@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func TestLoadLanguageConfig(t *testing.T) {
+	// Defaults keep the historical English and Russian databases.
+	paths, err := loadLanguageConfig(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"en": "./data/events.db", "ru": "./data/events_ru.db"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("unexpected default languages, got %v", paths)
+	}
+
+	// DB_PATH_<LANG> declares a language on its own and overrides default paths.
+	paths, err = loadLanguageConfig([]string{
+		"LANGUAGES=en, es",
+		"DB_PATH_EN=/data/en.db",
+		"DB_PATH_PT_BR=/data/pt.db",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = map[string]string{"en": "/data/en.db", "es": "./data/events_es.db", "pt-br": "/data/pt.db"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("unexpected languages, got %v", paths)
+	}
+
+	if _, err := loadLanguageConfig([]string{"LANGUAGES=en,../etc"}); err == nil {
+		t.Fatal("expected an error for an invalid language code")
+	}
+}
+
+func TestLanguageMiddlewareRejectsUnsupportedLanguage(t *testing.T) {
+	languageDBs = map[string]*gorm.DB{"en": {}, "ru": {}}
+	defer func() { languageDBs = map[string]*gorm.DB{} }()
+
+	app := fiber.New()
+	app.Get("/api/tags", languageMiddleware, func(c *fiber.Ctx) error {
+		lang, _ := requestLanguage(c)
+		return c.SendString(lang)
+	})
+
+	// 1. Registered language -> passed to the handler
+	req, _ := http.NewRequest(http.MethodGet, "/api/tags?lang=RU", nil)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", res.StatusCode)
+	}
+
+	// 2. Unknown language -> 400 listing the available languages
+	req2, _ := http.NewRequest(http.MethodGet, "/api/tags?lang=xx", nil)
+	res2, err := app.Test(req2)
+	if err != nil {
+		t.Fatalf("failed to perform request: %v", err)
+	}
+	if res2.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request, got %d", res2.StatusCode)
+	}
+	var body struct {
+		Error     string   `json:"error"`
+		Available []string `json:"available_languages"`
+	}
+	if err := json.NewDecoder(res2.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(body.Available, []string{"en", "ru"}) {
+		t.Fatalf("unexpected available languages, got %v", body.Available)
+	}
+}
+
+func TestNegotiateLanguage(t *testing.T) {
+	languageDBs = map[string]*gorm.DB{"en": {}, "ru": {}, "pt-br": {}}
+	defer func() { languageDBs = map[string]*gorm.DB{} }()
+
+	cases := []struct {
+		header  string
+		want    string
+		matched bool
+	}{
+		{"", "en", false},
+		{"ru-RU,ru;q=0.9,en-US;q=0.8,en;q=0.7", "ru", true},
+		{"de-DE,de;q=0.9,en;q=0.5", "en", true},
+		{"en;q=0.4, RU;q=0.8", "ru", true},
+		{"pt-BR", "pt-br", true},
+		{"ru;q=0, *;q=0.1", "en", true},
+		{"fr, de", "en", false},
+	}
+	for _, tc := range cases {
+		got, matched := negotiateLanguage(tc.header)
+		if got != tc.want || matched != tc.matched {
+			t.Fatalf("negotiateLanguage(%q) = %q, %v; want %q, %v", tc.header, got, matched, tc.want, tc.matched)
+		}
+	}
+}
+
+func TestFallbackToDefaultLanguage(t *testing.T) {
+	day := func(year int, month time.Month, d int) time.Time {
+		return time.Date(year, month, d, 0, 0, 0, 0, time.UTC)
+	}
+	api := newTestAPI(t)
+	en, ru := api.db, api.addLanguage("ru")
+	for db, events := range map[*gorm.DB][]Event{
+		en: {
+			{Title: "Genesis block", Date: day(2009, 1, 3), TranslationGroup: "genesis"},
+			{Title: "Bitcoin v0.1 released", Date: day(2009, 1, 9), TranslationGroup: "v0.1"},
+			{Title: "Bitcoin Pizza Day", Date: day(2010, 5, 22), TranslationGroup: "pizza"},
+			{Title: "Hal Finney receives bitcoin", Date: day(2009, 1, 12)},
+		},
+		ru: {
+			{Title: "Генезис-блок", Date: day(2009, 1, 3), TranslationGroup: "genesis"},
+			{Title: "Первый халвинг", Date: day(2012, 11, 28), TranslationGroup: "halving"},
+		},
+	} {
+		for _, e := range events {
+			if err := db.Create(&e).Error; err != nil {
+				t.Fatalf("failed to create event: %v", err)
+			}
+		}
+	}
+	// A translation in the trash does not count
+	trashed := Event{Title: "День пиццы", Date: day(2010, 5, 22), TranslationGroup: "pizza"}
+	if err := ru.Create(&trashed).Error; err != nil || ru.Delete(&trashed).Error != nil {
+		t.Fatalf("failed to create a trashed event: %v", err)
+	}
+
+	api.Get("/events", getAllEventsHandler)
+	api.Get("/events/date/:date", getEventsByDateHandler)
+	api.Get("/events/month/:month", getEventsByMonthHandler)
+	api.Get("/events/:id", getEventHandler)
+
+	get := func(path string, out interface{}) int {
+		return api.do(http.MethodGet, path, "", out)
+	}
+	titles := func(events []Event) []string {
+		got := []string{}
+		for _, e := range events {
+			if e.Fallback {
+				got = append(got, "fallback:"+e.Title)
+			} else {
+				got = append(got, e.Title)
+			}
+		}
+		return got
+	}
+
+	// 1. Lists add the default language events whose translation group is
+	// missing, in order; unlinked events and translated groups are not added
+	tests := []struct {
+		path  string
+		total int64
+		want  []string
+	}{
+		{"/api/events?lang=ru", 2, []string{"Первый халвинг", "Генезис-блок"}},
+		{"/api/events?lang=ru&fallback=true", 4, []string{"Первый халвинг", "fallback:Bitcoin Pizza Day", "fallback:Bitcoin v0.1 released", "Генезис-блок"}},
+		{"/api/events?lang=ru&fallback=true&limit=2&page=2", 4, []string{"fallback:Bitcoin v0.1 released", "Генезис-блок"}},
+		{"/api/events/date/01-09?lang=ru&fallback=true", 1, []string{"fallback:Bitcoin v0.1 released"}},
+		{"/api/events?lang=en&fallback=true", 4, []string{"Bitcoin Pizza Day", "Hal Finney receives bitcoin", "Bitcoin v0.1 released", "Genesis block"}},
+	}
+	for _, tt := range tests {
+		var body struct {
+			Events     []Event        `json:"events"`
+			Pagination PaginationData `json:"pagination"`
+		}
+		if status := get(tt.path, &body); status != http.StatusOK || body.Pagination.Total != tt.total || !reflect.DeepEqual(titles(body.Events), tt.want) {
+			t.Errorf("%s: expected %d events %v, got %d %d %v", tt.path, tt.total, tt.want, status, body.Pagination.Total, titles(body.Events))
+		}
+	}
+
+	// 2. The month view counts fallback events in its summary
+	var month MonthEventsResponse
+	get("/api/events/month/2009-01?lang=ru&fallback=true&sort=asc", &month)
+	wantSummary := []DayCount{{"2009-01-03", 1}, {"2009-01-09", 1}}
+	if !reflect.DeepEqual(month.Summary, wantSummary) || len(month.Days) != 2 || !month.Days[1].Events[0].Fallback {
+		t.Fatalf("expected summary %v with a fallback on 2009-01-09, got %v %+v", wantSummary, month.Summary, month.Days)
+	}
+
+	// 3. IDs are per language, so lookups by ID never fall back
+	if status := get("/api/events/3?lang=ru&fallback=true", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an ID missing in ru, got %d", status)
+	}
+}
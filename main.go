@@ -1,21 +1,22 @@
 package main
 
 import (
-	"crypto/subtle" // Added for secure API key comparison
-	// Added for parsing JSON tags
-	"errors" // Added for gorm.ErrRecordNotFound
+	"bytes"         // Added for re-encoding legacy responses
+	"encoding/json" // Added for parsing JSON tags
+	"errors"        // Added for gorm.ErrRecordNotFound
 	// Added for io.MultiWriter
 	// Added for io.MultiWriter
 	"log"     // Added for log.Fatal
+	"net/url" // Added for unescaping tag path parameters
 	"os"      // Added for sorting tags, os.Stdout, os.MkdirAll, os.OpenFile
+	"slices"  // Added for matching list field names
 	"strconv" // Added for pagination
 	"strings" // Added for tag processing
-	"time"    // Added for rate limiter
+	"time"    // Added for date parsing
 
 	"github.com/gofiber/adaptor/v2"
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"    // Added for CORS support
-	"github.com/gofiber/fiber/v2/middleware/limiter" // Added for rate limiting
+	"github.com/gofiber/fiber/v2/middleware/cors" // Added for CORS support
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
@@ -24,18 +25,6 @@ import (
 	// GORM is already used by database.go, no need for direct import here unless using DB functions directly
 )
 
-// Define global DB variables for English and Russian databases
-var DB_EN *gorm.DB
-var DB_RU *gorm.DB
-
-// Helper function to get the correct DB instance based on language
-func getDBInstance(langCode string) *gorm.DB {
-	if strings.ToLower(langCode) == "ru" {
-		return DB_RU
-	}
-	return DB_EN // Default to English
-}
-
 // Define a response structure for paginated events, matching your spec
 type PaginatedEventsResponse struct {
 	Events     []Event     `json:"events"`     // Changed from Data json:"data"
@@ -49,31 +38,113 @@ type PaginationData struct {
 	LastPage    int   `json:"last_page"`    // Was TotalPages int   `json:"total_pages"`
 }
 
-// var expectedAPIKey []byte // Old: single API key
-var validAPIKeys [][]byte // New: slice to hold multiple valid API keys
+// Event fields that the API serializes as JSON arrays
+var listFieldNames = []string{"tags", "media", "references"}
+
+// legacyStringsMiddleware serves tags, media and references as JSON-encoded
+// strings (e.g. "tags": "[\"a\",\"b\"]") when ?legacy_strings=true is set,
+// for consumers written before these fields became real JSON arrays. References
+// are reduced to their URLs, as they were before they became objects. Only the
+// event objects of the response are rewritten, so it belongs on event routes.
+func legacyStringsMiddleware(c *fiber.Ctx) error {
+	if !c.QueryBool("legacy_strings") {
+		return c.Next()
+	}
+	if err := c.Next(); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(string(c.Response().Header.ContentType()), fiber.MIMEApplicationJSON) {
+		return nil
+	}
 
-// authMiddleware checks for a valid API key
-func authMiddleware(c *fiber.Ctx) error {
-	providedKey := c.Get("X-API-KEY")
-	if providedKey == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "API key required"})
+	decoder := json.NewDecoder(bytes.NewReader(c.Response().Body()))
+	decoder.UseNumber()
+	var body map[string]interface{}
+	if err := decoder.Decode(&body); err != nil {
+		zlog.Error().Err(err).Msg("legacyStringsMiddleware: Failed to decode response body")
+		return nil
 	}
+	for _, event := range responseEvents(body) {
+		encodeListFieldsAsStrings(event)
+	}
+	legacyBody, err := json.Marshal(body)
+	if err != nil {
+		zlog.Error().Err(err).Msg("legacyStringsMiddleware: Failed to encode response body")
+		return nil
+	}
+	c.Response().SetBodyRaw(legacyBody)
+	return nil
+}
 
-	providedKeyBytes := []byte(providedKey)
-	for _, expectedKey := range validAPIKeys {
-		// Securely compare the provided key with each of the expected keys
-		if subtle.ConstantTimeCompare(providedKeyBytes, expectedKey) == 1 {
-			return c.Next()
+// responseEvents returns the decoded event objects of an event endpoint
+// response: "data" holding an event or a map of language variants, "events"
+// lists and the "events" of the month view's "days"
+func responseEvents(body map[string]interface{}) []map[string]interface{} {
+	var events []map[string]interface{}
+	add := func(v interface{}) {
+		if event, ok := v.(map[string]interface{}); ok {
+			events = append(events, event)
+		}
+	}
+	addAll := func(v interface{}) {
+		items, _ := v.([]interface{})
+		for _, item := range items {
+			add(item)
 		}
 	}
 
-	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid API key"})
+	if data, ok := body["data"].(map[string]interface{}); ok {
+		if _, isEvent := data["title"]; isEvent {
+			add(data)
+		} else {
+			for _, variant := range data {
+				add(variant)
+			}
+		}
+	}
+	addAll(body["events"])
+	days, _ := body["days"].([]interface{})
+	for _, day := range days {
+		if day, ok := day.(map[string]interface{}); ok {
+			addAll(day["events"])
+		}
+	}
+	return events
+}
+
+// encodeListFieldsAsStrings replaces the array values of the list fields of a
+// decoded event with their JSON encoding as a string
+func encodeListFieldsAsStrings(event map[string]interface{}) {
+	for _, k := range listFieldNames {
+		items, ok := event[k].([]interface{})
+		if !ok {
+			continue
+		}
+		if k == "references" {
+			items = referenceURLs(items)
+		}
+		if encoded, err := json.Marshal(items); err == nil {
+			event[k] = string(encoded)
+		}
+	}
+}
+
+// referenceURLs replaces decoded reference objects with their URL
+func referenceURLs(items []interface{}) []interface{} {
+	urls := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if ref, ok := item.(map[string]interface{}); ok {
+			urls = append(urls, ref["url"])
+			continue
+		}
+		urls = append(urls, item)
+	}
+	return urls
 }
 
 // New handler function for getting a single event
 func getEventHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en' if not specified
-	db := getDBInstance(lang)
+	lang, db := requestLanguage(c)
 	id := c.Params("id")
 
 	zlog.Info().Str("id", id).Str("lang", lang).Msg("getEventHandler called")
@@ -93,9 +164,10 @@ func getEventHandler(c *fiber.Ctx) error {
 		})
 	}
 
+	// IDs are per language, so there is no fallback to the default language
+	// here: /events/:id/translations finds the variants of an event
 	var event Event
 	result := db.First(&event, uint(eventID))
-
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
 			zlog.Warn().Str("id", id).Str("lang", lang).Err(result.Error).Msg("getEventHandler: Event not found")
@@ -109,6 +181,7 @@ func getEventHandler(c *fiber.Ctx) error {
 		})
 	}
 	zlog.Info().Str("id", id).Str("lang", lang).Msg("getEventHandler: Successfully retrieved event")
+	c.Set(fiber.HeaderETag, eventETag(&event))
 	return c.JSON(fiber.Map{"data": event})
 }
 
@@ -120,37 +193,26 @@ type TagInfo struct {
 
 // Handler for /api/tags
 func getTagsHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en' if not specified
-	db := getDBInstance(lang)
+	lang, db := requestLanguage(c)
 
 	zlog.Info().Str("lang", lang).Msg("getTagsHandler called")
 
 	var result []TagInfo
-	// SQL query to extract, count, and lowercase tags directly from JSON arrays in the 'tags' column.
-	// This approach assumes tags are stored as valid JSON arrays (e.g., ["tag1", "tag2"]).
-	// It replaces the previous Go-based parsing and aggregation logic.
-	// Note: Fallback for comma-separated tags is removed with this SQL-native approach.
-	// If tags are not valid JSON arrays, or if individual tags within the array are empty/whitespace-only,
-	// they will be ignored by this query.
+	// Tags are counted through the normalized tags/event_tags tables, which hold
+	// trimmed, lowercased tag names, so counting is case-insensitive. Trashed
+	// events keep their event_tags links and are left out through the events join.
 	sqlQuery := `
 SELECT
-    LOWER(j.value) AS tag,
+    t.name AS tag,
     COUNT(*) AS count
 FROM
-    events e,
-    json_each(e.tags) j
-WHERE
-    e.tags IS NOT NULL
-    AND e.tags != ''        -- Not an empty string literal
-    AND e.tags != '[]'      -- Not an empty JSON array string literal
-    AND json_valid(e.tags) = 1 -- Ensures the string is valid JSON
-    AND json_type(e.tags) = 'array' -- Ensures it's specifically a JSON array
-    AND j.value IS NOT NULL
-    AND TRIM(CAST(j.value AS TEXT)) != '' -- Ensures the extracted tag is not an empty or whitespace-only string
+    tags t
+    JOIN event_tags et ON et.tag_id = t.id
+    JOIN events e ON e.id = et.event_id AND e.deleted_at IS NULL
 GROUP BY
-    LOWER(j.value) -- Group by the lowercased tag for case-insensitive counting
+    t.id
 ORDER BY
-    tag ASC; -- Order alphabetically by the (now lowercased) tag
+    t.name ASC;
 `
 	if err := db.Raw(sqlQuery).Scan(&result).Error; err != nil {
 		zlog.Error().Str("lang", lang).Err(err).Msg("getTagsHandler: Error executing raw SQL for tags")
@@ -159,7 +221,7 @@ ORDER BY
 		})
 	}
 
-	// Sorting is now handled by the SQL query's "ORDER BY tag ASC".
+	// Sorting is now handled by the SQL query's "ORDER BY t.name ASC".
 	// The result slice is already in the correct []TagInfo format.
 	zlog.Info().Int("tag_count", len(result)).Str("lang", lang).Msg("getTagsHandler: Successfully retrieved tags")
 	return c.JSON(fiber.Map{"data": result})
@@ -167,9 +229,12 @@ ORDER BY
 
 // Handler for /api/events/tags/{tag}
 func getEventsByTagHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en' if not specified
-	db := getDBInstance(lang)
+	lang, db := requestLanguage(c)
 	tagParam := c.Params("tag")
+	// Path parameters are not unescaped by Fiber, tags may contain spaces or quotes
+	if unescaped, err := url.PathUnescape(tagParam); err == nil {
+		tagParam = unescaped
+	}
 	pageStr := c.Query("page", "1")
 	limitStr := c.Query("limit", "20")
 
@@ -198,13 +263,8 @@ func getEventsByTagHandler(c *fiber.Ctx) error {
 	var events []Event
 	var totalEvents int64
 
-	// Prepare the search term for LIKE query, expecting tags like ["tag1","searchtag","tag2"]
-	// This will search for the tag as a whole word within the JSON array string.
-	searchTerm := "%\"" + strings.ToLower(tagParam) + "\"%"
-
 	// Get total count of events matching the tag
-	// We need to apply the Where condition for Count as well.
-	countQuery := db.Model(&Event{}).Where("LOWER(tags) LIKE ?", searchTerm)
+	countQuery := db.Model(&Event{}).Scopes(withTag(tagParam))
 	if err := countQuery.Count(&totalEvents).Error; err != nil {
 		zlog.Error().Str("tag", tagParam).Str("lang", lang).Err(err).Msg("getEventsByTagHandler: Failed to count events by tag")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -214,7 +274,7 @@ func getEventsByTagHandler(c *fiber.Ctx) error {
 
 	// Get paginated events matching the tag
 	// Default sort by date descending
-	dataQuery := db.Model(&Event{}).Order("date desc").Limit(limit).Offset(offset).Where("LOWER(tags) LIKE ?", searchTerm)
+	dataQuery := db.Model(&Event{}).Order("date desc").Limit(limit).Offset(offset).Scopes(withTag(tagParam))
 	if err := dataQuery.Find(&events).Error; err != nil {
 		zlog.Error().Str("tag", tagParam).Str("lang", lang).Int("page", page).Int("limit", limit).Err(err).Msg("getEventsByTagHandler: Failed to retrieve events by tag")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -236,125 +296,470 @@ func getEventsByTagHandler(c *fiber.Ctx) error {
 	})
 }
 
-// Handler for creating a new event
+// Handler for creating a new event. With ?upsert=true, an event whose
+// external_id is already stored replaces that event instead. Stored events
+// that the new one may duplicate are listed in possible_duplicates.
 func createEventHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en'
-	db := getDBInstance(lang)
-	var event Event
+	lang, db := requestLanguage(c)
 
-	if err := c.BodyParser(&event); err != nil {
-		zlog.Warn().Str("lang", lang).Err(err).Msg("createEventHandler: Error parsing request body")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	event, err := parseEventInput(c.Body(), Event{})
+	if err != nil {
+		zlog.Warn().Str("lang", lang).Err(err).Msg("createEventHandler: Invalid event")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	// Basic validation
-	if event.Title == "" || event.Date.IsZero() {
-		zlog.Warn().Str("lang", lang).Msg("createEventHandler: Title and Date are required fields")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Title and Date are required fields"})
+	var replaced *Event
+	var duplicates []PossibleDuplicate
+	err = writeTransaction(c, db, func(tx *gorm.DB) error {
+		var err error
+		if replaced, err = saveEvent(tx, c, &event, c.QueryBool("upsert")); err != nil {
+			return err
+		}
+		duplicates, err = findPossibleDuplicates(tx, &event, defaultDuplicateOptions)
+		return err
+	})
+	var conflict *eventConflictError
+	if errors.As(err, &conflict) {
+		zlog.Warn().Uint("conflict_id", conflict.EventID).Str("lang", lang).Msg("createEventHandler: external_id already in use")
+		return c.Status(fiber.StatusConflict).JSON(conflict.response())
 	}
-
-	result := db.Create(&event)
-	if result.Error != nil {
-		zlog.Error().Str("lang", lang).Err(result.Error).Msg("createEventHandler: Failed to create event")
+	if err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("createEventHandler: Failed to create event")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create event"})
 	}
 
-	zlog.Info().Uint("id", event.ID).Str("lang", lang).Msg("createEventHandler: Event created successfully")
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"data": event})
+	status := fiber.StatusCreated
+	if replaced != nil {
+		status = fiber.StatusOK
+	}
+	body := fiber.Map{"data": event}
+	if len(duplicates) > 0 {
+		body["possible_duplicates"] = duplicates
+	}
+	if isDryRun(c) {
+		return c.Status(status).JSON(withDryRun(c, body))
+	}
+
+	if replaced != nil {
+		writeAudit(newAuditEntry(c, auditUpdate, lang, replaced, &event))
+		zlog.Info().Uint("id", event.ID).Str("lang", lang).Msg("createEventHandler: Event updated by external_id")
+	} else {
+		writeAudit(newAuditEntry(c, auditCreate, lang, nil, &event))
+		zlog.Info().Uint("id", event.ID).Str("lang", lang).Msg("createEventHandler: Event created successfully")
+	}
+	return c.Status(status).JSON(body)
 }
 
-// Handler for updating an existing event
-func updateEventHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en'
-	db := getDBInstance(lang)
-	id := c.Params("id")
-	eventID, err := strconv.ParseUint(id, 10, 32)
+// findEvent loads the event named by the :id route parameter for a write, and
+// rejects the request with 412 when its If-Match header does not match the
+// event's ETag. When it returns a nil event, the error response has been
+// written and err is the result of writing it.
+func findEvent(c *fiber.Ctx, db *gorm.DB, lang, handler string) (*Event, error) {
+	eventID, err := strconv.ParseUint(c.Params("id"), 10, 32)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
 	}
-
 	var event Event
 	if err := db.First(&event, uint(eventID)).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+		zlog.Error().Uint64("id", eventID).Str("lang", lang).Err(err).Msg(handler + ": Failed to retrieve event")
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	if !ifMatchSatisfied(c, &event) {
+		zlog.Warn().Uint("id", event.ID).Str("lang", lang).Msg(handler + ": If-Match does not match")
+		return nil, preconditionFailed(c, &event)
+	}
+	return &event, nil
+}
+
+// Handler for replacing an existing event. The body is a full event: fields
+// left out are cleared. PATCH changes only the fields it contains.
+func updateEventHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	event, err := findEvent(c, db, lang, "updateEventHandler")
+	if event == nil {
+		return err
 	}
 
-	var updateData map[string]interface{}
-	if err := c.BodyParser(&updateData); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	replacement, err := parseEventInput(c.Body(), Event{})
+	if err != nil {
+		zlog.Warn().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("updateEventHandler: Invalid event")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
 	}
 
-	if err := db.Model(&event).Updates(updateData).Error; err != nil {
+	if err := updateEvent(c, db, lang, event, eventUpdateData(&replacement), auditUpdate); err != nil {
+		var conflict *eventConflictError
+		if errors.As(err, &conflict) {
+			return c.Status(fiber.StatusConflict).JSON(conflict.response())
+		}
+		if errors.Is(err, errEventModified) {
+			return preconditionFailed(c, nil)
+		}
+		zlog.Error().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("updateEventHandler: Failed to update event")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update event"})
 	}
 
-	return c.JSON(fiber.Map{"data": event})
+	if !isDryRun(c) {
+		c.Set(fiber.HeaderETag, eventETag(event))
+	}
+	return c.JSON(withDryRun(c, fiber.Map{"data": event}))
 }
 
 // Handler for deleting an event
 func deleteEventHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en'
-	db := getDBInstance(lang)
-	id := c.Params("id")
-	eventID, err := strconv.ParseUint(id, 10, 32)
-	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
+	lang, db := requestLanguage(c)
+
+	// Load the event first so the audit log keeps its content
+	event, err := findEvent(c, db, lang, "deleteEventHandler")
+	if event == nil {
+		return err
 	}
 
-	result := db.Delete(&Event{}, uint(eventID))
-	if result.Error != nil {
+	var rowsAffected int64
+	err = writeTransaction(c, db, func(tx *gorm.DB) error {
+		if c.Get(fiber.HeaderIfMatch) != "" {
+			// Only delete the version the client has seen
+			if err := checkUnchanged(tx, event); err != nil {
+				return err
+			}
+		}
+		result := tx.Delete(&Event{}, event.ID)
+		rowsAffected = result.RowsAffected
+		return result.Error
+	})
+	if errors.Is(err, errEventModified) {
+		return preconditionFailed(c, nil)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to delete event"})
 	}
-	if result.RowsAffected == 0 {
+	if rowsAffected == 0 {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
 	}
+	if isDryRun(c) {
+		// A dry run has no 204: it answers with the event that would be trashed
+		return c.JSON(withDryRun(c, fiber.Map{"data": event}))
+	}
+	writeAudit(newAuditEntry(c, auditDelete, lang, event, nil))
 
 	return c.SendStatus(fiber.StatusNoContent)
 }
 
-// Handler for batch creating events
-func batchCreateEventsHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en'
-	db := getDBInstance(lang)
-	var events []Event
+// Accepted layouts for the /api/events/date/:date path parameter
+const (
+	dayOfYearLayout = "01-02"      // MM-DD, matches the day across all years
+	fullDateLayout  = "2006-01-02" // YYYY-MM-DD, matches a single calendar day
+)
 
-	if err := c.BodyParser(&events); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+// parsePagination reads the page and limit query parameters, falling back to
+// page 1 and 20 items per page on missing or invalid values.
+func parsePagination(c *fiber.Ctx) (page, limit, offset int) {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	limit, err = strconv.Atoi(c.Query("limit", "20"))
+	if err != nil || limit < 1 {
+		limit = 20
 	}
+	return page, limit, (page - 1) * limit
+}
 
-	if len(events) == 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "No events provided in the batch"})
+// parseSortOrder maps the sort query parameter ("asc" or "desc") to an ORDER BY
+// clause on the date column. Events are sorted newest first by default.
+func parseSortOrder(c *fiber.Ctx) (string, error) {
+	switch strings.ToLower(c.Query("sort", "desc")) {
+	case "desc":
+		return "date desc", nil
+	case "asc":
+		return "date asc", nil
+	default:
+		return "", errors.New("sort must be either 'asc' or 'desc'")
 	}
+}
 
-	result := db.Create(&events)
-	if result.Error != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to create events in batch"})
+// newPaginationData builds the pagination block shared by all list endpoints.
+func newPaginationData(page, limit int, total int64) PaginationData {
+	return PaginationData{
+		CurrentPage: page,
+		LastPage:    int((total + int64(limit) - 1) / int64(limit)),
+		PerPage:     limit,
+		Total:       total,
+	}
+}
+
+// Handler for /api/events/date/{date}
+// Accepts either MM-DD ("on this day" across all years) or YYYY-MM-DD.
+func getEventsByDateHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	dateParam := c.Params("date")
+
+	zlog.Info().Str("date", dateParam).Str("lang", lang).Msg("getEventsByDateHandler called")
+
+	var dateFilter string
+	if _, err := time.Parse(fullDateLayout, dateParam); err == nil {
+		dateFilter = "strftime('%Y-%m-%d', date) = ?"
+	} else if _, err := time.Parse(dayOfYearLayout, dateParam); err == nil {
+		dateFilter = "strftime('%m-%d', date) = ?"
+	} else {
+		zlog.Warn().Str("date", dateParam).Str("lang", lang).Msg("getEventsByDateHandler: Invalid date format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":            "Invalid date format",
+			"date":             dateParam,
+			"expected_formats": []string{"MM-DD", "YYYY-MM-DD"},
+		})
+	}
+
+	order, err := parseSortOrder(c)
+	if err != nil {
+		zlog.Warn().Str("sort", c.Query("sort")).Str("lang", lang).Msg("getEventsByDateHandler: Invalid sort parameter")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, limit, offset := parsePagination(c)
+
+	list := eventList{
+		filter: func(tx *gorm.DB) *gorm.DB { return tx.Where(dateFilter, dateParam) },
+		order:  order,
+		before: byDate(order),
+	}
+	events, totalEvents, err := list.find(c, lang, db, limit, offset)
+	if err != nil {
+		zlog.Error().Str("date", dateParam).Str("lang", lang).Err(err).Msg("getEventsByDateHandler: Failed to retrieve events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve events",
+		})
 	}
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message":      "Batch creation successful",
-		"events_added": result.RowsAffected,
+	zlog.Info().Int("event_count", len(events)).Int64("total_matching", totalEvents).Str("date", dateParam).Str("lang", lang).Msg("getEventsByDateHandler: Successfully retrieved events")
+
+	return c.JSON(PaginatedEventsResponse{
+		Events:     events,
+		Pagination: newPaginationData(page, limit, totalEvents),
 	})
 }
 
-// Handler for /api/events/by-date/{date}
-func getEventsByDateHandler(c *fiber.Ctx) error {
-	// Implementation similar to getEventsByTagHandler, but filtering by date
-	return c.SendString("Handler for getting events by date: Not Implemented")
+// Accepted layouts for the /api/events/month/:month path parameter
+const (
+	monthLayout     = "01"      // MM, matches the month across all years
+	yearMonthLayout = "2006-01" // YYYY-MM, matches a single calendar month
+)
+
+// DayCount is one entry of the per-day summary returned by the month view
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// DayEvents groups the events of the current page that share the same day
+type DayEvents struct {
+	Date   string  `json:"date"`
+	Events []Event `json:"events"`
 }
 
-// Handler for /api/events/by-month/{month}
+// Response structure for /api/events/month/{month}
+type MonthEventsResponse struct {
+	Month      string         `json:"month"`
+	Days       []DayEvents    `json:"days"`    // Events of the current page, grouped by day
+	Summary    []DayCount     `json:"summary"` // Event count for every day of the month that has events
+	Pagination PaginationData `json:"pagination"`
+}
+
+// Handler for /api/events/month/{month}
+// Accepts either MM (the month across all years) or YYYY-MM. Days are keyed as
+// MM-DD or YYYY-MM-DD respectively, so they can be passed to /api/events/date/{date}.
 func getEventsByMonthHandler(c *fiber.Ctx) error {
-	// Implementation similar to getEventsByTagHandler, but filtering by month
-	return c.SendString("Handler for getting events by month: Not Implemented")
+	lang, db := requestLanguage(c)
+	monthParam := c.Params("month")
+
+	zlog.Info().Str("month", monthParam).Str("lang", lang).Msg("getEventsByMonthHandler called")
+
+	var monthFilter, dayKey, dayLayout string
+	if _, err := time.Parse(yearMonthLayout, monthParam); err == nil {
+		monthFilter = "strftime('%Y-%m', date) = ?"
+		dayKey = "strftime('%Y-%m-%d', date)"
+		dayLayout = fullDateLayout
+	} else if _, err := time.Parse(monthLayout, monthParam); err == nil {
+		monthFilter = "strftime('%m', date) = ?"
+		dayKey = "strftime('%m-%d', date)"
+		dayLayout = dayOfYearLayout
+	} else {
+		zlog.Warn().Str("month", monthParam).Str("lang", lang).Msg("getEventsByMonthHandler: Invalid month format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error":            "Invalid month format",
+			"month":            monthParam,
+			"expected_formats": []string{"MM", "YYYY-MM"},
+		})
+	}
+
+	order, err := parseSortOrder(c)
+	if err != nil {
+		zlog.Warn().Str("sort", c.Query("sort")).Str("lang", lang).Msg("getEventsByMonthHandler: Invalid sort parameter")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	page, limit, offset := parsePagination(c)
+
+	filter := func(tx *gorm.DB) *gorm.DB { return tx.Where(monthFilter, monthParam) }
+
+	// The per-day summary covers the whole month
+	countPerDay := func(db *gorm.DB, scopes ...func(*gorm.DB) *gorm.DB) ([]DayCount, error) {
+		counts := []DayCount{}
+		err := db.Model(&Event{}).
+			Select(dayKey + " AS date, COUNT(*) AS count").
+			Scopes(scopes...).
+			Group(dayKey).
+			Order(dayKey + " asc").
+			Scan(&counts).Error
+		return counts, err
+	}
+	summary, err := countPerDay(db, filter)
+	if err == nil && fallbackRequested(c, lang) {
+		var fallbacks []DayCount
+		err = withMissingTranslations(db, func(defaultDB *gorm.DB, missing func(*gorm.DB) *gorm.DB) error {
+			var err error
+			fallbacks, err = countPerDay(defaultDB, filter, missing)
+			return err
+		})
+		summary = mergeDayCounts(summary, fallbacks)
+	}
+	if err != nil {
+		zlog.Error().Str("month", monthParam).Str("lang", lang).Err(err).Msg("getEventsByMonthHandler: Failed to count events per day")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to count events",
+		})
+	}
+
+	// Order by day first so that events of the same day are adjacent across years
+	direction := strings.TrimPrefix(order, "date ")
+	sameOrder := byDate(order)
+	list := eventList{
+		filter: filter,
+		order:  dayKey + " " + direction + ", " + order,
+		before: func(a, b *Event) bool {
+			dayA, dayB := a.Date.UTC().Format(dayLayout), b.Date.UTC().Format(dayLayout)
+			if dayA != dayB {
+				return (dayA < dayB) == (direction == "asc")
+			}
+			return sameOrder(a, b)
+		},
+	}
+	events, totalEvents, err := list.find(c, lang, db, limit, offset)
+	if err != nil {
+		zlog.Error().Str("month", monthParam).Str("lang", lang).Err(err).Msg("getEventsByMonthHandler: Failed to retrieve events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to retrieve events",
+		})
+	}
+
+	days := []DayEvents{}
+	for _, event := range events {
+		date := event.Date.UTC().Format(dayLayout) // UTC, as strftime keys the summary
+		if len(days) == 0 || days[len(days)-1].Date != date {
+			days = append(days, DayEvents{Date: date})
+		}
+		days[len(days)-1].Events = append(days[len(days)-1].Events, event)
+	}
+
+	zlog.Info().Int("event_count", len(events)).Int("day_count", len(summary)).Int64("total_matching", totalEvents).Str("month", monthParam).Str("lang", lang).Msg("getEventsByMonthHandler: Successfully retrieved events")
+
+	return c.JSON(MonthEventsResponse{
+		Month:      monthParam,
+		Days:       days,
+		Summary:    summary,
+		Pagination: newPaginationData(page, limit, totalEvents),
+	})
+}
+
+// mergeDayCounts adds the counts of b to a, both sorted by date
+func mergeDayCounts(a, b []DayCount) []DayCount {
+	counts := map[string]int64{}
+	for _, day := range append(slices.Clone(a), b...) {
+		counts[day.Date] += day.Count
+	}
+	merged := make([]DayCount, 0, len(counts))
+	for date, count := range counts {
+		merged = append(merged, DayCount{Date: date, Count: count})
+	}
+	slices.SortFunc(merged, func(x, y DayCount) int { return strings.Compare(x.Date, y.Date) })
+	return merged
+}
+
+// Handler for /api/heatmap
+// Returns event counts per day computed with a grouped query over events.date, so
+// calendar views can colour their cells without fetching the events themselves.
+// Without a year the counts are per day-of-year (MM-DD) across all years; with a
+// year (and optionally a month) they are per calendar date (YYYY-MM-DD).
+func getHeatmapHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	yearStr := c.Query("year")
+	monthStr := c.Query("month")
+	tagParam := c.Query("tag")
+
+	zlog.Info().Str("lang", lang).Str("year", yearStr).Str("month", monthStr).Str("tag", tagParam).Msg("getHeatmapHandler called")
+
+	if yearStr != "" {
+		if _, err := time.Parse("2006", yearStr); err != nil {
+			zlog.Warn().Str("year", yearStr).Str("lang", lang).Msg("getHeatmapHandler: Invalid year parameter")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "year must be in YYYY format"})
+		}
+	}
+	if monthStr != "" {
+		// Accept both single-digit ("5") and double-digit ("05") months, as /api/events does
+		if len(monthStr) == 1 {
+			monthStr = "0" + monthStr
+		}
+		if _, err := time.Parse(monthLayout, monthStr); err != nil {
+			zlog.Warn().Str("month", monthStr).Str("lang", lang).Msg("getHeatmapHandler: Invalid month parameter")
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "month must be between 01 and 12"})
+		}
+	}
+
+	granularity := "day_of_year"
+	dayKey := "strftime('%m-%d', date)"
+	if yearStr != "" {
+		granularity = "date"
+		dayKey = "strftime('%Y-%m-%d', date)"
+	}
+
+	query := db.Model(&Event{})
+	if yearStr != "" {
+		query = query.Where("strftime('%Y', date) = ?", yearStr)
+	}
+	if monthStr != "" {
+		query = query.Where("strftime('%m', date) = ?", monthStr)
+	}
+	if tagParam != "" {
+		query = query.Scopes(withTag(tagParam))
+	}
+
+	counts := []DayCount{}
+	if err := query.Select(dayKey + " AS date, COUNT(*) AS count").
+		Group(dayKey).
+		Order(dayKey + " asc").
+		Scan(&counts).Error; err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("getHeatmapHandler: Failed to aggregate events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to aggregate events",
+		})
+	}
+
+	var totalEvents int64
+	for _, day := range counts {
+		totalEvents += day.Count
+	}
+
+	zlog.Info().Int("day_count", len(counts)).Int64("total_matching", totalEvents).Str("lang", lang).Msg("getHeatmapHandler: Successfully aggregated events")
+	return c.JSON(fiber.Map{
+		"granularity": granularity,
+		"total":       totalEvents,
+		"data":        counts,
+	})
 }
 
 // Handler for getting all events (replaces the inline function in main)
 func getAllEventsHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en")
-	db := getDBInstance(lang)
+	lang, db := requestLanguage(c)
 	pageStr := c.Query("page", "1")
 	limitStr := c.Query("limit", "20")
 	yearStr := c.Query("year")
@@ -373,40 +778,33 @@ func getAllEventsHandler(c *fiber.Ctx) error {
 	}
 	offset := (page - 1) * limit
 
-	var events []Event
-	var totalEvents int64
-	query := db.Model(&Event{})
-
-	// Apply date filters if they are provided
-	if yearStr != "" {
-		query = query.Where("strftime('%Y', date) = ?", yearStr)
+	// Ensure month and day are two-digit ("01"–"12", "01"–"31") so that they match the
+	// %m and %d formats returned by strftime. Accept both "1" and "01" inputs.
+	if len(monthStr) == 1 {
+		monthStr = "0" + monthStr
 	}
-	if monthStr != "" {
-		// Ensure month is two-digit ("01"–"12") so that it matches the %m format returned by strftime.
-		// Accept both single-digit ("1") and double-digit ("01") inputs.
-		if len(monthStr) == 1 {
-			monthStr = "0" + monthStr
-		}
-		query = query.Where("strftime('%m', date) = ?", monthStr)
+	if len(dayStr) == 1 {
+		dayStr = "0" + dayStr
 	}
-	if dayStr != "" {
-		// Similar padding for day ("01"–"31").
-		if len(dayStr) == 1 {
-			dayStr = "0" + dayStr
-		}
-		query = query.Where("strftime('%d', date) = ?", dayStr)
-	}
-
-	// First, get the total count of records that match the filter
-	if err := query.Count(&totalEvents).Error; err != nil {
-		zlog.Error().Str("lang", lang).Err(err).Msg("getAllEventsHandler: Failed to count events")
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to count events",
-		})
+	list := eventList{
+		// Apply date filters if they are provided
+		filter: func(tx *gorm.DB) *gorm.DB {
+			if yearStr != "" {
+				tx = tx.Where("strftime('%Y', date) = ?", yearStr)
+			}
+			if monthStr != "" {
+				tx = tx.Where("strftime('%m', date) = ?", monthStr)
+			}
+			if dayStr != "" {
+				tx = tx.Where("strftime('%d', date) = ?", dayStr)
+			}
+			return tx
+		},
+		order:  "date desc",
+		before: byDate("date desc"),
 	}
-
-	// Then, apply pagination and retrieve the events
-	if err := query.Order("date desc").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+	events, totalEvents, err := list.find(c, lang, db, limit, offset)
+	if err != nil {
 		zlog.Error().Str("lang", lang).Err(err).Msg("getAllEventsHandler: Failed to retrieve events")
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to retrieve events",
@@ -430,8 +828,7 @@ func getAllEventsHandler(c *fiber.Ctx) error {
 
 // Handler for FTS5 search
 func ftsSearchHandler(c *fiber.Ctx) error {
-	lang := c.Query("lang", "en") // Default to 'en' if not specified
-	db := getDBInstance(lang)
+	lang, db := requestLanguage(c)
 	query := c.Query("q")
 	pageStr := c.Query("page", "1")
 	limitStr := c.Query("limit", "20")
@@ -459,11 +856,12 @@ func ftsSearchHandler(c *fiber.Ctx) error {
 	// Sanitize FTS query
 	sanitizedQuery := strings.ReplaceAll(query, "\"", "\"\"")
 
+	// Trashed events stay in events_fts until they are purged, so they are filtered here
 	countSQL := `
 		SELECT COUNT(*)
 		FROM events e
 		JOIN events_fts fts ON e.id = fts.rowid
-		WHERE events_fts MATCH ?;
+		WHERE events_fts MATCH ? AND e.deleted_at IS NULL;
 	`
 	if err := db.Raw(countSQL, sanitizedQuery).Scan(&totalEvents).Error; err != nil {
 		zlog.Error().Str("query", query).Str("lang", lang).Err(err).Msg("ftsSearchHandler: Failed to count search results")
@@ -471,10 +869,10 @@ func ftsSearchHandler(c *fiber.Ctx) error {
 	}
 
 	searchSQL := `
-		SELECT e.id, e.date, e.title, e.description, e.tags, e.media, e.references, fts.rank
+		SELECT e.id, e.date, e.title, e.description, e.tags, e.media, e."references", e.translation_group, fts.rank
 		FROM events e
 		JOIN events_fts fts ON e.id = fts.rowid
-		WHERE events_fts MATCH ?
+		WHERE events_fts MATCH ? AND e.deleted_at IS NULL
 		ORDER BY fts.rank
 		LIMIT ? OFFSET ?;
 	`
@@ -519,53 +917,64 @@ func main() {
 	}()
 
 	// --- API Key Setup ---
-	apiKeysStr := os.Getenv("API_KEYS")
-	if apiKeysStr == "" {
-		log.Fatal("API_KEYS environment variable is not set. Authentication is required.")
-	}
-	keys := strings.Split(apiKeysStr, ",")
-	if len(keys) == 0 || (len(keys) == 1 && keys[0] == "") {
-		log.Fatal("API_KEYS environment variable is empty or not properly formatted (comma-separated).")
-	}
-	for _, k := range keys {
-		trimmedKey := strings.TrimSpace(k)
-		if trimmedKey != "" {
-			validAPIKeys = append(validAPIKeys, []byte(trimmedKey))
-		}
+	// API_KEYS is optional now that keys can be managed in the api_keys table,
+	// but at least one admin key is needed to create the first stored key.
+	keys, err := parseAPIKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		log.Fatalf("API_KEYS environment variable is not properly formatted: %v", err)
 	}
-	if len(validAPIKeys) == 0 {
-		log.Fatal("No valid API keys found after parsing API_KEYS. Please check the format.")
+	validAPIKeys = keys
+	keyNames := make([]string, 0, len(keys))
+	for _, key := range keys {
+		keyNames = append(keyNames, key.key.Name)
 	}
-	zlog.Info().Int("keys_loaded", len(validAPIKeys)).Msg("API keys loaded")
+	zlog.Info().Int("keys_loaded", len(validAPIKeys)).Strs("key_names", keyNames).Msg("API keys loaded from API_KEYS")
 
-	// --- Database Initialization for API ---
-	dbPathEN := os.Getenv("DB_PATH_EN")
-	if dbPathEN == "" {
-		dbPathEN = "./data/events.db"
+	if err := loadRateLimitConfig(); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadAnonymousAccessConfig(); err != nil {
+		log.Fatal(err)
 	}
-	dbPathRU := os.Getenv("DB_PATH_RU")
-	if dbPathRU == "" {
-		dbPathRU = "./data/events_ru.db"
+	zlog.Info().Bool("anonymous_access", anonymousAccess).Int64("anonymous_rate_limit", anonymousRateLimit).Msg("Anonymous access configured")
+	if err := loadIdempotencyConfig(); err != nil {
+		log.Fatal(err)
 	}
 
+	// --- Database Initialization for API ---
 	if _, err := os.Stat("./data"); os.IsNotExist(err) {
 		if mkdirErr := os.MkdirAll("./data", 0755); mkdirErr != nil {
 			zlog.Fatal().Err(mkdirErr).Msg("Failed to create data directory")
 		}
 	}
 
-	var err error
-	DB_EN, err = InitDB(dbPathEN)
-	if err != nil {
-		zlog.Fatal().Err(err).Msg("Failed to initialize English database")
+	if err := initLanguageDBs(); err != nil {
+		zlog.Fatal().Err(err).Msg("Failed to initialize language databases")
+	}
+	zlog.Info().Strs("languages", availableLanguages()).Str("default_language", defaultLanguage).Msg("Language databases initialized")
+
+	systemDBPath := os.Getenv("SYSTEM_DB_PATH")
+	if systemDBPath == "" {
+		systemDBPath = "./data/system.db"
+	}
+	if systemDB, err = InitSystemDB(systemDBPath); err != nil {
+		zlog.Fatal().Err(err).Str("db_path", systemDBPath).Msg("Failed to initialize system database")
+	}
+	var storedKeys int64
+	if err := systemDB.Model(&APIKey{}).Where("revoked = ?", false).Count(&storedKeys).Error; err != nil {
+		zlog.Fatal().Err(err).Msg("Failed to count stored API keys")
+	}
+	if len(validAPIKeys) == 0 && storedKeys == 0 {
+		log.Fatal("No API keys configured. Set API_KEYS to bootstrap an admin key. Authentication is required.")
 	}
-	zlog.Info().Str("db_path", dbPathEN).Msg("English database initialized")
+	zlog.Info().Int64("stored_keys", storedKeys).Str("db_path", systemDBPath).Msg("System database initialized")
+	go cleanUpIdempotencyKeys(systemDB, idempotencyCleanupInterval)
 
-	DB_RU, err = InitDB(dbPathRU)
+	limiterBackend, err := initLimiterStorage()
 	if err != nil {
-		zlog.Fatal().Err(err).Msg("Failed to initialize Russian database")
+		zlog.Fatal().Err(err).Msg("Failed to initialize rate limit storage")
 	}
-	zlog.Info().Str("db_path", dbPathRU).Msg("Russian database initialized")
+	zlog.Info().Str("storage", limiterBackend).Int64("default_rate_limit", defaultRateLimit).Int64("failed_auth_rate_limit", failedAuthRateLimit).Msg("Rate limit storage initialized")
 
 	// --- Fiber App Initialization ---
 	app := fiber.New()
@@ -575,46 +984,75 @@ func main() {
 		Output: os.Stdout,
 	}))
 
-	app.Use(limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: 1 * time.Minute,
-		KeyGenerator: func(c *fiber.Ctx) string {
-			return c.IP()
-		},
-		LimitReached: func(c *fiber.Ctx) error {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Rate limit exceeded, please try again later.",
-			})
-		},
-	}))
-
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     getAllowedOrigins(),
-		AllowMethods:     "GET,HEAD,OPTIONS,POST,PUT,DELETE",
-		AllowHeaders:     "X-API-KEY,Content-Type",
+		AllowMethods:     "GET,HEAD,OPTIONS,POST,PUT,PATCH,DELETE",
+		AllowHeaders:     "X-API-KEY,Content-Type,If-Match,Idempotency-Key",
+		ExposeHeaders:    "X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After,Content-Language,ETag,Idempotent-Replayed",
 		AllowCredentials: false,
 	}))
 
 	// Setup routes
-	api := app.Group("/api", authMiddleware)
+	api := app.Group("/api", failedAuthLimiter(), authMiddleware, rateLimitMiddleware, languageMiddleware)
+	read, write := requireScope(scopeEventsRead), requireScope(scopeEventsWrite)
+	legacy := legacyStringsMiddleware // On the routes that respond with events
 
 	// Existing endpoints
-	api.Get("/events/:id", getEventHandler)
-	api.Get("/tags", getTagsHandler)
-	api.Get("/events/tags/:tag", getEventsByTagHandler)
-	api.Post("/events", createEventHandler)
-	api.Put("/events/:id", updateEventHandler)
-	api.Delete("/events/:id", deleteEventHandler)
-	api.Post("/events/batch", batchCreateEventsHandler)
-	api.Get("/events/date/:date", getEventsByDateHandler)
-	api.Get("/events/month/:month", getEventsByMonthHandler)
-	api.Get("/events", getAllEventsHandler)
-	api.Post("/migrate", migrateHandler)
+	api.Get("/events/:id", read, legacy, getEventHandler)
+	api.Get("/tags", read, getTagsHandler)
+	api.Get("/events/tags/:tag", read, legacy, getEventsByTagHandler)
+	api.Post("/events", write, legacy, idempotencyMiddleware, createEventHandler)
+	api.Put("/events/:id", write, legacy, updateEventHandler)
+	api.Patch("/events/:id", write, legacy, patchEventHandler)
+	api.Delete("/events/:id", write, legacy, deleteEventHandler)
+	api.Post("/events/batch", write, idempotencyMiddleware, batchCreateEventsHandler)
+	api.Get("/events/date/:date", read, legacy, getEventsByDateHandler)
+	api.Get("/events/month/:month", read, legacy, getEventsByMonthHandler)
+	api.Get("/heatmap", read, getHeatmapHandler)
+	api.Get("/events/:id/translations", read, legacy, getEventTranslationsHandler)
+	api.Get("/translations/coverage", read, getTranslationCoverageHandler)
+
+	// Revision history
+	api.Get("/events/:id/revisions", read, getEventRevisionsHandler)
+	api.Get("/events/:id/revisions/diff", read, getEventRevisionDiffHandler)
+	api.Get("/events/:id/revisions/:revision", read, getEventRevisionHandler)
+	api.Post("/events/:id/revisions/:revision/restore", write, restoreEventRevisionHandler)
+
+	// Tag management
+	admin := api.Group("/admin", requireScope(scopeAdmin))
+	admin.Post("/tags/rename", renameTagHandler)
+	admin.Post("/tags/merge", mergeTagsHandler)
+	admin.Get("/tags/aliases", getTagAliasesHandler)
+	admin.Put("/tags/aliases/:alias", putTagAliasHandler)
+	admin.Delete("/tags/aliases/:alias", deleteTagAliasHandler)
+	admin.Delete("/tags/:tag", deleteTagHandler)
+
+	// API key management
+	admin.Post("/keys", createAPIKeyHandler)
+	admin.Get("/keys", listAPIKeysHandler)
+	admin.Post("/keys/:id/rotate", rotateAPIKeyHandler)
+	admin.Post("/keys/:id/revoke", revokeAPIKeyHandler)
+	admin.Put("/keys/:id/limits", updateAPIKeyLimitsHandler)
+	admin.Get("/keys/:id/usage", getAPIKeyUsageHandler)
+
+	// Audit log
+	admin.Get("/audit", getAuditLogHandler)
+
+	// Trash
+	admin.Get("/trash", getTrashHandler)
+	admin.Post("/trash/:id/restore", restoreTrashedEventHandler)
+	admin.Delete("/trash/:id", purgeTrashedEventHandler)
+	admin.Delete("/trash", emptyTrashHandler)
+
+	// Duplicate detection
+	admin.Get("/duplicates", getDuplicatesHandler)
+	admin.Post("/duplicates/merge", mergeDuplicatesHandler)
+
+	api.Get("/events", read, legacy, getAllEventsHandler)
+	api.Post("/migrate", requireScope(scopeAdmin), migrateHandler)
 
 	// New FTS5 search endpoint, replacing the old /search
-	api.Get("/search", ftsSearchHandler)
-
-
+	api.Get("/search", read, legacy, ftsSearchHandler)
 
 	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
 
@@ -627,5 +1065,3 @@ func migrateHandler(c *fiber.Ctx) error {
 	// Placeholder implementation
 	return c.SendString("Migration endpoint hit")
 }
-
-
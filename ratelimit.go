@@ -0,0 +1,307 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	zlog "github.com/rs/zerolog/log"
+)
+
+// defaultRateLimit is the number of requests per minute allowed to a key
+// without its own rate_limit, including the keys configured in API_KEYS.
+// It can be changed with RATE_LIMIT_PER_MINUTE.
+var defaultRateLimit int64 = 100
+
+// failedAuthRateLimit is the number of requests per minute from an IP address
+// that may fail authentication (FAILED_AUTH_RATE_LIMIT_PER_MINUTE)
+var failedAuthRateLimit int64 = 20
+
+// Key under which rateLimitMiddleware stores the X-RateLimit-* values of the
+// request's key in c.Locals
+const localsRateLimitHeaders = "rate_limit_headers"
+
+// limitWindow is a fixed window in which requests are counted
+type limitWindow struct {
+	Name  string // "minute", "day" or "month"
+	Start time.Time
+	End   time.Time
+}
+
+// limitWindows returns the minute, day and month windows containing now, in UTC
+func limitWindows(now time.Time) (minute, day, month limitWindow) {
+	now = now.UTC()
+	minuteStart := now.Truncate(time.Minute)
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return limitWindow{"minute", minuteStart, minuteStart.Add(time.Minute)},
+		limitWindow{"day", dayStart, dayStart.AddDate(0, 0, 1)},
+		limitWindow{"month", monthStart, monthStart.AddDate(0, 1, 0)}
+}
+
+// counterKey names the counter of a key in a window
+func (w limitWindow) counterKey(identity string) string {
+	return fmt.Sprintf("%s:%s:%d", identity, w.Name, w.Start.Unix())
+}
+
+// resetSeconds returns the number of seconds until the window ends, at least 1
+func (w limitWindow) resetSeconds(now time.Time) int64 {
+	return max(int64(w.End.Sub(now).Seconds()+0.999), 1)
+}
+
+// limiterIdentity returns the name under which the requests of a key are counted
+func (k *APIKey) limiterIdentity() string {
+	if k.limiterKey != "" {
+		return k.limiterKey
+	}
+	if k.ID == 0 {
+		return "static:" + k.Name
+	}
+	return "key:" + strconv.FormatUint(uint64(k.ID), 10)
+}
+
+// rateLimit returns the requests per minute allowed to the key
+func (k *APIKey) rateLimit() int64 {
+	if k.RateLimit > 0 {
+		return k.RateLimit
+	}
+	return defaultRateLimit
+}
+
+// loadRateLimitConfig reads RATE_LIMIT_PER_MINUTE and FAILED_AUTH_RATE_LIMIT_PER_MINUTE
+func loadRateLimitConfig() error {
+	for _, setting := range []struct {
+		name  string
+		value *int64
+	}{
+		{"RATE_LIMIT_PER_MINUTE", &defaultRateLimit},
+		{"FAILED_AUTH_RATE_LIMIT_PER_MINUTE", &failedAuthRateLimit},
+	} {
+		if v := os.Getenv(setting.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("%s must be a positive integer, got %q", setting.name, v)
+			}
+			*setting.value = n
+		}
+	}
+	return nil
+}
+
+// failedAuthLimiter limits per client IP address the requests that fail
+// authentication, with a wrong key or without one. It runs before authMiddleware,
+// so once an address is over the limit its requests are rejected without looking
+// their key up, and keys cannot be guessed. Requests with a key authMiddleware
+// knows without a lookup and anonymous reads are not counted, nor are requests
+// that turn out to authenticate. Its counters are kept
+// in limiterStorage, so initLimiterStorage must have run.
+func failedAuthLimiter() fiber.Handler {
+	limit := limiter.New(limiter.Config{
+		Next: func(c *fiber.Ctx) bool {
+			providedKey := c.Get("X-API-KEY")
+			if providedKey == "" {
+				// Anonymous reads are limited per IP address by rateLimitMiddleware
+				return anonymousAccess && (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead)
+			}
+			return knownAPIKey(providedKey)
+		},
+		Max:        int(failedAuthRateLimit),
+		Expiration: time.Minute,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "auth:" + c.IP()
+		},
+		SkipSuccessfulRequests: true,
+		Storage:                limiterStorage,
+		LimitReached: func(c *fiber.Ctx) error {
+			zlog.Warn().Str("ip", c.IP()).Int64("limit", failedAuthRateLimit).Msg("failedAuthLimiter: Too many failed authentications")
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": "Too many failed authentication attempts, please try again later.",
+			})
+		},
+	})
+	return func(c *fiber.Ctx) error {
+		err := limit(c)
+		// The limiter sets X-RateLimit-* to its own counter, but a request that
+		// authenticated reports the limit of its key
+		if h, ok := c.Locals(localsRateLimitHeaders).([3]int64); ok {
+			setRateLimitHeaders(c, h[0], h[1], h[2])
+		}
+		return err
+	}
+}
+
+// setRateLimitHeaders reports the per-minute limit, the requests left and the
+// seconds until the window resets
+func setRateLimitHeaders(c *fiber.Ctx, limit, remaining, reset int64) {
+	c.Locals(localsRateLimitHeaders, [3]int64{limit, remaining, reset})
+	c.Set("X-RateLimit-Limit", strconv.FormatInt(limit, 10))
+	c.Set("X-RateLimit-Remaining", strconv.FormatInt(remaining, 10))
+	c.Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+}
+
+// rateLimitMiddleware enforces the per-minute rate limit and the daily and
+// monthly quotas of the request's API key, or of the client IP address for
+// anonymous requests. It must run after authMiddleware.
+// The per-minute limit is reported in X-RateLimit-Limit, X-RateLimit-Remaining
+// and X-RateLimit-Reset (seconds until the window resets); quotas in
+// X-Quota-Daily-Remaining and X-Quota-Monthly-Remaining when the key has them.
+func rateLimitMiddleware(c *fiber.Ctx) error {
+	key := requestAPIKey(c)
+	if key == nil {
+		return c.Next()
+	}
+	identity := key.limiterIdentity()
+	now := time.Now()
+	minute, day, month := limitWindows(now)
+
+	limit := key.rateLimit()
+	count, err := limiterStorage.Increment(minute.counterKey(identity), minute.End)
+	if err != nil {
+		// Failing open keeps the API available when the counter storage has a problem
+		zlog.Error().Str("api_key", identity).Err(err).Msg("rateLimitMiddleware: Failed to count request")
+		return c.Next()
+	}
+	remaining := max(limit-count, 0)
+	setRateLimitHeaders(c, limit, remaining, minute.resetSeconds(now))
+	if count > limit {
+		c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(minute.resetSeconds(now), 10))
+		zlog.Warn().Str("api_key", identity).Int64("limit", limit).Msg("rateLimitMiddleware: Rate limit exceeded")
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Rate limit exceeded, please try again later.",
+		})
+	}
+
+	// A request is counted in each window up to the one rejecting it, so requests
+	// rejected by the rate limit do not use up the quotas
+	quotas := []struct {
+		window limitWindow
+		quota  int64
+		label  string
+		header string
+	}{
+		{day, key.DailyQuota, "Daily", "X-Quota-Daily-Remaining"},
+		{month, key.MonthlyQuota, "Monthly", "X-Quota-Monthly-Remaining"},
+	}
+	for _, q := range quotas {
+		used, err := limiterStorage.Increment(q.window.counterKey(identity), q.window.End)
+		if err != nil {
+			zlog.Error().Str("api_key", identity).Err(err).Msg("rateLimitMiddleware: Failed to count request")
+			continue
+		}
+		if q.quota <= 0 {
+			continue
+		}
+		c.Set(q.header, strconv.FormatInt(max(q.quota-used, 0), 10))
+		if used > q.quota {
+			c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(q.window.resetSeconds(now), 10))
+			zlog.Warn().Str("api_key", identity).Str("window", q.window.Name).Int64("quota", q.quota).Msg("rateLimitMiddleware: Quota exceeded")
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"error": fmt.Sprintf("%s quota of %d requests exceeded", q.label, q.quota),
+				"quota": q.window.Name,
+			})
+		}
+	}
+
+	return c.Next()
+}
+
+// UsageWindow reports the requests counted for a key in the current window
+type UsageWindow struct {
+	Used  int64     `json:"used"`  // Requests counted so far, including those this window rejected
+	Limit int64     `json:"limit"` // 0 means unlimited
+	Reset time.Time `json:"reset"` // End of the window
+}
+
+// APIKeyUsage is the response of GET /api/admin/keys/{id}/usage
+type APIKeyUsage struct {
+	KeyID  uint        `json:"key_id"`
+	Minute UsageWindow `json:"minute"`
+	Day    UsageWindow `json:"day"`
+	Month  UsageWindow `json:"month"`
+}
+
+// apiKeyUsage reads the current counters of a key
+func apiKeyUsage(key *APIKey, now time.Time) (APIKeyUsage, error) {
+	usage := APIKeyUsage{KeyID: key.ID}
+	minute, day, month := limitWindows(now)
+	for _, w := range []struct {
+		window limitWindow
+		limit  int64
+		usage  *UsageWindow
+	}{
+		{minute, key.rateLimit(), &usage.Minute},
+		{day, key.DailyQuota, &usage.Day},
+		{month, key.MonthlyQuota, &usage.Month},
+	} {
+		used, err := limiterStorage.Count(w.window.counterKey(key.limiterIdentity()))
+		if err != nil {
+			return usage, err
+		}
+		*w.usage = UsageWindow{Used: used, Limit: w.limit, Reset: w.window.End}
+	}
+	return usage, nil
+}
+
+// Handler for GET /api/admin/keys/{id}/usage
+// Returns the requests counted for a key in the current minute, day and month.
+func getAPIKeyUsageHandler(c *fiber.Ctx) error {
+	key, err := findAPIKey(c, "getAPIKeyUsageHandler")
+	if key == nil {
+		return err
+	}
+	usage, err := apiKeyUsage(key, time.Now())
+	if err != nil {
+		zlog.Error().Uint("api_key_id", key.ID).Err(err).Msg("getAPIKeyUsageHandler: Failed to read usage counters")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to read usage counters"})
+	}
+	return c.JSON(fiber.Map{"data": usage})
+}
+
+// APIKeyLimitsRequest is the body of PUT /api/admin/keys/{id}/limits.
+// Zero means the default rate limit or no quota.
+type APIKeyLimitsRequest struct {
+	RateLimit    int64 `json:"rate_limit"`
+	DailyQuota   int64 `json:"daily_quota"`
+	MonthlyQuota int64 `json:"monthly_quota"`
+}
+
+func (r APIKeyLimitsRequest) validate() error {
+	if r.RateLimit < 0 || r.DailyQuota < 0 || r.MonthlyQuota < 0 {
+		return fmt.Errorf("'rate_limit', 'daily_quota' and 'monthly_quota' must not be negative")
+	}
+	return nil
+}
+
+// Handler for PUT /api/admin/keys/{id}/limits
+// Replaces the rate limit and quotas of a key.
+func updateAPIKeyLimitsHandler(c *fiber.Ctx) error {
+	key, err := findAPIKey(c, "updateAPIKeyLimitsHandler")
+	if key == nil {
+		return err
+	}
+	var req APIKeyLimitsRequest
+	if err := c.BodyParser(&req); err != nil {
+		zlog.Warn().Err(err).Msg("updateAPIKeyLimitsHandler: Cannot parse JSON")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	if err := req.validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	key.RateLimit, key.DailyQuota, key.MonthlyQuota = req.RateLimit, req.DailyQuota, req.MonthlyQuota
+	if err := systemDB.Model(key).Updates(map[string]interface{}{
+		"rate_limit":    key.RateLimit,
+		"daily_quota":   key.DailyQuota,
+		"monthly_quota": key.MonthlyQuota,
+	}).Error; err != nil {
+		zlog.Error().Uint("api_key_id", key.ID).Err(err).Msg("updateAPIKeyLimitsHandler: Failed to store limits")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update API key limits"})
+	}
+	forgetAPIKey(key.KeyHash)
+
+	zlog.Info().Uint("api_key_id", key.ID).Int64("rate_limit", key.RateLimit).Int64("daily_quota", key.DailyQuota).Int64("monthly_quota", key.MonthlyQuota).Msg("updateAPIKeyLimitsHandler: Limits updated")
+	return c.JSON(fiber.Map{"data": key})
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// LimiterStorage stores the request counters of the rate limiter and quotas,
+// and as a fiber.Storage the entries of failedAuthLimiter
+type LimiterStorage interface {
+	fiber.Storage
+
+	// Increment adds one to a counter and returns its new value. A counter that
+	// does not exist yet starts at zero; it may be dropped after expiresAt.
+	Increment(key string, expiresAt time.Time) (int64, error)
+	// Count returns the value of a counter, zero when it does not exist
+	Count(key string) (int64, error)
+}
+
+// limiterStorage holds the counters used by rateLimitMiddleware and failedAuthLimiter
+var limiterStorage LimiterStorage = newMemoryLimiterStorage()
+
+// How often expired counters and entries are removed
+const limiterSweepInterval = time.Minute
+
+// initLimiterStorage selects the counter storage from RATE_LIMIT_STORAGE:
+// "sqlite" (default) keeps counters in RATE_LIMIT_DB_PATH so they survive
+// restarts and are shared by replicas using the same file, "memory" keeps them
+// in this process only.
+func initLimiterStorage() (string, error) {
+	switch backend := strings.ToLower(os.Getenv("RATE_LIMIT_STORAGE")); backend {
+	case "", "sqlite":
+		path := os.Getenv("RATE_LIMIT_DB_PATH")
+		if path == "" {
+			path = "./data/ratelimit.db"
+		}
+		storage, err := newSQLiteLimiterStorage(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to open rate limit database at %s: %w", path, err)
+		}
+		limiterStorage = storage
+		return "sqlite:" + path, nil
+	case "memory":
+		limiterStorage = newMemoryLimiterStorage()
+		return "memory", nil
+	default:
+		return "", fmt.Errorf("RATE_LIMIT_STORAGE must be 'sqlite' or 'memory', got %q", backend)
+	}
+}
+
+type memoryCounter struct {
+	value     int64
+	expiresAt time.Time
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time // Zero for entries that do not expire
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// memoryLimiterStorage keeps counters and entries in process memory
+type memoryLimiterStorage struct {
+	mu        sync.Mutex
+	counters  map[string]memoryCounter
+	entries   map[string]memoryEntry
+	lastSweep time.Time
+}
+
+func newMemoryLimiterStorage() *memoryLimiterStorage {
+	return &memoryLimiterStorage{counters: map[string]memoryCounter{}, entries: map[string]memoryEntry{}, lastSweep: time.Now()}
+}
+
+// sweep removes expired counters and entries at most once per limiterSweepInterval.
+// The caller holds s.mu.
+func (s *memoryLimiterStorage) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < limiterSweepInterval {
+		return
+	}
+	for k, counter := range s.counters {
+		if now.After(counter.expiresAt) {
+			delete(s.counters, k)
+		}
+	}
+	for k, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+	s.lastSweep = now
+}
+
+func (s *memoryLimiterStorage) Increment(key string, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(time.Now())
+	counter := s.counters[key]
+	counter.value++
+	counter.expiresAt = expiresAt
+	s.counters[key] = counter
+	return counter.value, nil
+}
+
+func (s *memoryLimiterStorage) Count(key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.counters[key].value, nil
+}
+
+func (s *memoryLimiterStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return nil, nil
+	}
+	return entry.value, nil
+}
+
+func (s *memoryLimiterStorage) Set(key string, value []byte, exp time.Duration) error {
+	if key == "" || len(value) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+	entry := memoryEntry{value: slices.Clone(value)}
+	if exp > 0 {
+		entry.expiresAt = now.Add(exp)
+	}
+	s.entries[key] = entry
+	return nil
+}
+
+func (s *memoryLimiterStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+// Reset removes every counter and entry
+func (s *memoryLimiterStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counters, s.entries = map[string]memoryCounter{}, map[string]memoryEntry{}
+	return nil
+}
+
+func (s *memoryLimiterStorage) Close() error {
+	return nil
+}
+
+// RateLimitCounter is a row of the rate_limit_counters table
+type RateLimitCounter struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Value     int64  `gorm:"not null"`
+	ExpiresAt int64  `gorm:"not null;index:idx_rate_limit_counters_expires_at"` // Unix seconds
+}
+
+// RateLimitEntry is a row of the rate_limit_entries table, which stores the
+// fiber.Storage entries
+type RateLimitEntry struct {
+	Key       string `gorm:"primaryKey;size:255"`
+	Value     []byte `gorm:"not null"`
+	ExpiresAt int64  `gorm:"not null;index:idx_rate_limit_entries_expires_at"` // Unix seconds, 0 for entries that do not expire
+}
+
+// sqliteLimiterStorage keeps counters and entries in an SQLite database. Every
+// increment or write is a single upsert, so several processes can share the same file.
+type sqliteLimiterStorage struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func newSQLiteLimiterStorage(dbPath string) (*sqliteLimiterStorage, error) {
+	// busy_timeout lets concurrent writers from other replicas wait for the lock
+	db, err := gorm.Open(sqlite.Open(dbPath+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.AutoMigrate(&RateLimitCounter{}, &RateLimitEntry{}); err != nil {
+		return nil, err
+	}
+	return &sqliteLimiterStorage{db: db, lastSweep: time.Now()}, nil
+}
+
+// sweep removes expired counters and entries at most once per limiterSweepInterval
+func (s *sqliteLimiterStorage) sweep(now time.Time) error {
+	s.mu.Lock()
+	sweep := now.Sub(s.lastSweep) >= limiterSweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+	if !sweep {
+		return nil
+	}
+	if err := s.db.Where("expires_at < ?", now.Unix()).Delete(&RateLimitCounter{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("expires_at > 0 AND expires_at < ?", now.Unix()).Delete(&RateLimitEntry{}).Error
+}
+
+func (s *sqliteLimiterStorage) Increment(key string, expiresAt time.Time) (int64, error) {
+	if err := s.sweep(time.Now()); err != nil {
+		return 0, err
+	}
+
+	var value int64
+	err := s.db.Raw(`
+		INSERT INTO rate_limit_counters (key, value, expires_at) VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET value = value + 1, expires_at = excluded.expires_at
+		RETURNING value`, key, expiresAt.Unix()).Scan(&value).Error
+	return value, err
+}
+
+func (s *sqliteLimiterStorage) Count(key string) (int64, error) {
+	var counters []RateLimitCounter
+	if err := s.db.Where("key = ?", key).Limit(1).Find(&counters).Error; err != nil {
+		return 0, err
+	}
+	if len(counters) == 0 {
+		return 0, nil
+	}
+	return counters[0].Value, nil
+}
+
+func (s *sqliteLimiterStorage) Get(key string) ([]byte, error) {
+	var entries []RateLimitEntry
+	if err := s.db.Where("key = ? AND (expires_at = 0 OR expires_at >= ?)", key, time.Now().Unix()).Limit(1).Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	return entries[0].Value, nil
+}
+
+func (s *sqliteLimiterStorage) Set(key string, value []byte, exp time.Duration) error {
+	if key == "" || len(value) == 0 {
+		return nil
+	}
+	now := time.Now()
+	if err := s.sweep(now); err != nil {
+		return err
+	}
+	var expiresAt int64
+	if exp > 0 {
+		expiresAt = now.Add(exp).Unix()
+	}
+	return s.db.Exec(`
+		INSERT INTO rate_limit_entries (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`, key, value, expiresAt).Error
+}
+
+func (s *sqliteLimiterStorage) Delete(key string) error {
+	return s.db.Where("key = ?", key).Delete(&RateLimitEntry{}).Error
+}
+
+// Reset removes every counter and entry
+func (s *sqliteLimiterStorage) Reset() error {
+	if err := s.db.Where("1 = 1").Delete(&RateLimitCounter{}).Error; err != nil {
+		return err
+	}
+	return s.db.Where("1 = 1").Delete(&RateLimitEntry{}).Error
+}
+
+func (s *sqliteLimiterStorage) Close() error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
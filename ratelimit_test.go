@@ -0,0 +1,178 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiterStorage = newMemoryLimiterStorage()
+	keys := map[string]*APIKey{
+		"limited": {ID: 1, RateLimit: 2},
+		"quota":   {ID: 2, RateLimit: 100, DailyQuota: 3},
+	}
+	defer func() { limiterStorage = newMemoryLimiterStorage() }()
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(localsAPIKey, keys[c.Get("X-API-KEY")])
+		return c.Next()
+	}, rateLimitMiddleware)
+	app.Get("/api/events", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	do := func(key string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "/api/events", nil)
+		req.Header.Set("X-API-KEY", key)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		return res
+	}
+
+	// 1. Per-key rate limit with X-RateLimit headers
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		res := do("limited")
+		if res.StatusCode != want {
+			t.Fatalf("request %d: expected %d, got %d", i+1, want, res.StatusCode)
+		}
+		if res.Header.Get("X-RateLimit-Limit") != "2" || res.Header.Get("X-RateLimit-Reset") == "" {
+			t.Fatalf("request %d: unexpected rate limit headers %v", i+1, res.Header)
+		}
+	}
+	// Another key is not affected by the first one's limit
+	if res := do("quota"); res.StatusCode != http.StatusOK {
+		t.Fatalf("expected a different key to be allowed, got %d", res.StatusCode)
+	}
+
+	// 2. Daily quota
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		res := do("quota")
+		if res.StatusCode != want {
+			t.Fatalf("quota request %d: expected %d, got %d", i+2, want, res.StatusCode)
+		}
+	}
+
+	usage, err := apiKeyUsage(keys["quota"], time.Now())
+	if err != nil {
+		t.Fatalf("apiKeyUsage failed: %v", err)
+	}
+	if usage.Day.Used != 4 || usage.Day.Limit != 3 || usage.Month.Used != 3 {
+		t.Fatalf("unexpected usage counters: %+v", usage)
+	}
+}
+
+func TestFailedAuthLimiter(t *testing.T) {
+	db, err := InitSystemDB(filepath.Join(t.TempDir(), "system.db"))
+	if err != nil {
+		t.Fatalf("InitSystemDB failed: %v", err)
+	}
+	stored := APIKey{Name: "stored", KeyHash: hashAPIKey("bcal_stored"), Scopes: StringList{scopeEventsRead}, RateLimit: 50}
+	if err := db.Create(&stored).Error; err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	systemDB, validAPIKeys = db, []staticAPIKey{{secret: []byte("static"), key: &APIKey{Name: "static"}}}
+	failedAuthRateLimit = 2
+	limiterStorage = newMemoryLimiterStorage()
+	defer func() {
+		systemDB, validAPIKeys, failedAuthRateLimit = nil, nil, 20
+		limiterStorage = newMemoryLimiterStorage()
+	}()
+
+	app := fiber.New()
+	app.Use("/api", failedAuthLimiter(), authMiddleware, rateLimitMiddleware)
+	app.Get("/api/events", func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	do := func(key string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, "/api/events", nil)
+		req.Header.Set("X-API-KEY", key)
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("failed to perform request: %v", err)
+		}
+		return res
+	}
+
+	// 1. A stored key that is not cached yet is looked up and not counted as a
+	// failure, and reports its own limit
+	res := do("bcal_stored")
+	if res.StatusCode != http.StatusOK || res.Header.Get("X-RateLimit-Limit") != "50" {
+		t.Fatalf("expected 200 with the key's limit, got %d %v", res.StatusCode, res.Header)
+	}
+
+	// 2. Wrong keys are rejected without a lookup once the address is over the limit
+	for i, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		if res := do("guess"); res.StatusCode != want {
+			t.Fatalf("guess %d: expected %d, got %d", i+1, want, res.StatusCode)
+		}
+	}
+	if res := do("bcal_other"); res.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("expected an unknown key to be rejected by the limit, got %d", res.StatusCode)
+	}
+
+	// 3. Known keys are not held up by the failures of their address
+	for _, key := range []string{"static", "bcal_stored"} {
+		if res := do(key); res.StatusCode != http.StatusOK {
+			t.Errorf("%s: expected 200 OK, got %d", key, res.StatusCode)
+		}
+	}
+}
+
+func TestSQLiteLimiterStorageIsShared(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ratelimit.db")
+	first, err := newSQLiteLimiterStorage(path)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+	second, err := newSQLiteLimiterStorage(path)
+	if err != nil {
+		t.Fatalf("failed to open storage: %v", err)
+	}
+
+	// Two replicas incrementing the same counter concurrently
+	expiresAt := time.Now().Add(time.Minute)
+	var wg sync.WaitGroup
+	for _, storage := range []*sqliteLimiterStorage{first, second} {
+		wg.Add(1)
+		go func(s *sqliteLimiterStorage) {
+			defer wg.Done()
+			for i := 0; i < 25; i++ {
+				if _, err := s.Increment("key:1:minute:0", expiresAt); err != nil {
+					t.Errorf("Increment failed: %v", err)
+				}
+			}
+		}(storage)
+	}
+	wg.Wait()
+
+	// Counters survive reopening the database
+	reopened, err := newSQLiteLimiterStorage(path)
+	if err != nil {
+		t.Fatalf("failed to reopen storage: %v", err)
+	}
+	if got, err := reopened.Count("key:1:minute:0"); err != nil || got != 50 {
+		t.Fatalf("expected 50 counted requests, got %d (%v)", got, err)
+	}
+	if got, err := reopened.Count("key:2:minute:0"); err != nil || got != 0 {
+		t.Fatalf("expected 0 for an unknown counter, got %d (%v)", got, err)
+	}
+
+	// Entries of Fiber's limiter are shared as well
+	if err := first.Set("auth:192.0.2.1", []byte("hits"), time.Minute); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := second.Get("auth:192.0.2.1"); err != nil || string(got) != "hits" {
+		t.Fatalf("expected the entry set by another replica, got %q (%v)", got, err)
+	}
+	if err := second.Delete("auth:192.0.2.1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if got, err := first.Get("auth:192.0.2.1"); err != nil || got != nil {
+		t.Fatalf("expected a deleted entry to be gone, got %q (%v)", got, err)
+	}
+}
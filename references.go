@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// errInvalidReferences is wrapped by every references validation error
+var errInvalidReferences = errors.New("references must be a JSON array of URL strings or reference objects")
+
+// Supported values of Reference.Type
+var referenceTypes = []string{"bitcointalk", "mailing_list", "news", "paper", "tweet"}
+
+// Accepted layouts for Reference.PublishedAt, from the most to the least precise
+var referenceDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// Reference is a source of an event. Older events only carry the URL.
+type Reference struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Author      string `json:"author,omitempty"`
+	PublishedAt string `json:"published_at,omitempty"` // YYYY-MM-DD, YYYY-MM or YYYY
+	Type        string `json:"type,omitempty"`         // One of referenceTypes
+	ArchiveURL  string `json:"archive_url,omitempty"`  // archive.org snapshot of URL
+}
+
+// validate checks the fields of a reference submitted through the API
+func (r Reference) validate() error {
+	if !isHTTPURL(r.URL) {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	if r.Type != "" && !slices.Contains(referenceTypes, r.Type) {
+		return fmt.Errorf("type must be one of %s", strings.Join(referenceTypes, ", "))
+	}
+	if r.PublishedAt != "" && !slices.ContainsFunc(referenceDateLayouts, func(layout string) bool {
+		_, err := time.Parse(layout, r.PublishedAt)
+		return err == nil
+	}) {
+		return errors.New("published_at must be in YYYY-MM-DD, YYYY-MM or YYYY format")
+	}
+	if r.ArchiveURL != "" {
+		u, err := url.Parse(r.ArchiveURL)
+		if err != nil || !isHTTPURL(r.ArchiveURL) || (u.Hostname() != "archive.org" && !strings.HasSuffix(u.Hostname(), ".archive.org")) {
+			return errors.New("archive_url must be an archive.org URL")
+		}
+	}
+	return nil
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// UnmarshalJSON accepts either a bare URL string or a reference object
+func (r *Reference) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '"' {
+		var u string
+		if err := json.Unmarshal(b, &u); err != nil {
+			return err
+		}
+		*r = Reference{URL: strings.TrimSpace(u)}
+		return nil
+	}
+
+	type plainReference Reference // Avoids recursing into this method
+	var plain plainReference
+	if err := json.Unmarshal(b, &plain); err != nil {
+		return err
+	}
+	*r = Reference(plain)
+	r.URL = strings.TrimSpace(r.URL)
+	return nil
+}
+
+// ReferenceList is stored as a JSON array in the references column. Items are
+// written as objects; items stored as bare URL strings are still read.
+type ReferenceList []Reference
+
+// Value stores the list as a JSON array string, an empty list as "[]"
+func (l ReferenceList) Value() (driver.Value, error) {
+	if l == nil {
+		return "[]", nil
+	}
+	b, err := json.Marshal([]Reference(l))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads the references column. Like StringList, it keeps values that are
+// not a JSON array as a single URL rather than failing the query.
+func (l *ReferenceList) Scan(src interface{}) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into ReferenceList", src)
+	}
+
+	raw = strings.TrimSpace(raw)
+	*l = ReferenceList{}
+	if raw == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(raw), (*[]Reference)(l)); err != nil {
+		*l = ReferenceList{{URL: raw}}
+	}
+	return nil
+}
+
+// MarshalJSON always renders an array, never null
+func (l ReferenceList) MarshalJSON() ([]byte, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]Reference(l))
+}
+
+// UnmarshalJSON accepts a JSON array whose items are URL strings or reference
+// objects, as well as the legacy form of a string holding such an array. It
+// only decodes, so stored data written before a validation rule existed can
+// still be read back; client input is checked with validate.
+func (l *ReferenceList) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		*l = ReferenceList{}
+		return nil
+	}
+	if len(b) > 0 && b[0] == '"' {
+		var legacy string
+		if err := json.Unmarshal(b, &legacy); err != nil {
+			return errInvalidReferences
+		}
+		if strings.TrimSpace(legacy) == "" {
+			*l = ReferenceList{}
+			return nil
+		}
+		b = []byte(legacy)
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(b, &items); err != nil || items == nil {
+		return errInvalidReferences
+	}
+	refs := make(ReferenceList, 0, len(items))
+	for i, item := range items {
+		var ref Reference
+		if err := json.Unmarshal(item, &ref); err != nil {
+			return fmt.Errorf("%w: reference %d is neither a URL string nor a reference object", errInvalidReferences, i)
+		}
+		refs = append(refs, ref)
+	}
+	*l = refs
+	return nil
+}
+
+// validate checks every reference of a list submitted through the API
+func (l ReferenceList) validate() error {
+	for i, ref := range l {
+		if err := ref.validate(); err != nil {
+			return fmt.Errorf("%w: reference %d: %v", errInvalidReferences, i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReferenceListUnmarshalJSON(t *testing.T) {
+	var refs ReferenceList
+	input := `[
+		"https://bitcoin.org/bitcoin.pdf",
+		{
+			"url": "https://www.metzdowd.com/pipermail/cryptography/2008-October/014810.html",
+			"title": "Bitcoin P2P e-cash paper",
+			"author": "Satoshi Nakamoto",
+			"published_at": "2008-10-31",
+			"type": "mailing_list",
+			"archive_url": "https://web.archive.org/web/2008/https://www.metzdowd.com/"
+		}
+	]`
+	if err := json.Unmarshal([]byte(input), &refs); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ReferenceList{
+		{URL: "https://bitcoin.org/bitcoin.pdf"},
+		{
+			URL:         "https://www.metzdowd.com/pipermail/cryptography/2008-October/014810.html",
+			Title:       "Bitcoin P2P e-cash paper",
+			Author:      "Satoshi Nakamoto",
+			PublishedAt: "2008-10-31",
+			Type:        "mailing_list",
+			ArchiveURL:  "https://web.archive.org/web/2008/https://www.metzdowd.com/",
+		},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Fatalf("got %#v, want %#v", refs, want)
+	}
+
+	for _, input := range []string{`[42]`, `"https://example.com"`, `{"url": "https://example.com"}`} {
+		var refs ReferenceList
+		if err := json.Unmarshal([]byte(input), &refs); !errors.Is(err, errInvalidReferences) {
+			t.Fatalf("%s: expected errInvalidReferences, got %v", input, err)
+		}
+	}
+
+	// Decoding does not validate, so stored references are always readable
+	invalid := []string{
+		`["not a url"]`,
+		`[{"title": "missing url"}]`,
+		`[{"url": "https://example.com", "type": "blog"}]`,
+		`[{"url": "https://example.com", "published_at": "31.10.2008"}]`,
+		`[{"url": "https://example.com", "archive_url": "https://example.org/snapshot"}]`,
+	}
+	for _, input := range invalid {
+		var refs ReferenceList
+		if err := json.Unmarshal([]byte(input), &refs); err != nil {
+			t.Fatalf("%s: unexpected decode error: %v", input, err)
+		}
+		if err := refs.validate(); !errors.Is(err, errInvalidReferences) {
+			t.Fatalf("%s: expected errInvalidReferences, got %v", input, err)
+		}
+	}
+	if err := want.validate(); err != nil {
+		t.Fatalf("unexpected validation error: %v", err)
+	}
+}
+
+func TestReferenceListScan(t *testing.T) {
+	var refs ReferenceList
+	if err := refs.Scan(`["https://a.example", {"url": "https://b.example", "type": "news"}]`); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ReferenceList{{URL: "https://a.example"}, {URL: "https://b.example", Type: "news"}}
+	if !reflect.DeepEqual(refs, want) {
+		t.Fatalf("got %#v, want %#v", refs, want)
+	}
+}
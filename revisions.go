@@ -0,0 +1,285 @@
+package main
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Revision action for the state of an event before its first recorded change,
+// stored for events created before revisions were kept
+const revisionBaseline = "baseline"
+
+// EventSnapshot is the full content of an event at a revision, stored as a JSON object
+type EventSnapshot Event
+
+// Value stores the snapshot as a JSON object string
+func (s EventSnapshot) Value() (driver.Value, error) {
+	b, err := json.Marshal(Event(s))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan reads a snapshot stored as a JSON object string. References are decoded
+// as a plain list, so snapshots keep loading whatever rules they were written under.
+func (s *EventSnapshot) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return fmt.Errorf("cannot scan %T into EventSnapshot", src)
+	}
+	type plainEvent Event
+	snapshot := struct {
+		*plainEvent
+		References *[]Reference `json:"references"`
+	}{(*plainEvent)(s), (*[]Reference)(&s.References)}
+	return json.Unmarshal(raw, &snapshot)
+}
+
+// EventRevision is a row of the event_revisions table, stored in the language
+// database next to its event. Revisions are numbered from 1 per event.
+type EventRevision struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	EventID   uint          `json:"event_id" gorm:"not null;uniqueIndex:idx_event_revisions_event_revision,priority:1"`
+	Revision  int           `json:"revision" gorm:"not null;uniqueIndex:idx_event_revisions_event_revision,priority:2"`
+	Action    string        `json:"action" gorm:"size:32;not null"` // The audit action that produced the revision, or "baseline"
+	KeyName   string        `json:"key_name" gorm:"size:255"`
+	Snapshot  EventSnapshot `json:"snapshot" gorm:"type:text;not null"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// recordRevision stores the event as its next revision. It must run in the
+// transaction that wrote the event, after the write.
+func recordRevision(tx *gorm.DB, c *fiber.Ctx, event *Event, action string) error {
+	var last int
+	if err := tx.Model(&EventRevision{}).Where("event_id = ?", event.ID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&last).Error; err != nil {
+		return err
+	}
+	revision := EventRevision{
+		EventID:   event.ID,
+		Revision:  last + 1,
+		Action:    action,
+		Snapshot:  EventSnapshot(*event),
+		CreatedAt: time.Now().UTC(),
+	}
+	if key := requestAPIKey(c); key != nil {
+		revision.KeyName = key.Name
+	}
+	return tx.Create(&revision).Error
+}
+
+// ensureBaselineRevision stores the event as revision 1 when it has no
+// revisions yet, so the content overwritten by its first update is kept.
+// It must run before the update, in the same transaction.
+func ensureBaselineRevision(tx *gorm.DB, event *Event) error {
+	var count int64
+	if err := tx.Model(&EventRevision{}).Where("event_id = ?", event.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	return tx.Create(&EventRevision{
+		EventID:   event.ID,
+		Revision:  1,
+		Action:    revisionBaseline,
+		Snapshot:  EventSnapshot(*event),
+		CreatedAt: event.UpdatedAt.UTC(),
+	}).Error
+}
+
+// insertEvent creates the event with its first revision. It must run in a
+// transaction; the caller writes the audit entry once it is committed.
+func insertEvent(tx *gorm.DB, c *fiber.Ctx, event *Event) error {
+	if err := tx.Create(event).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, c, event, auditCreate)
+}
+
+// applyEventUpdate applies updateData to the event and records the new
+// revision. It must run in a transaction. event is reloaded with the stored
+// row. The write only applies if the row is still the one that was loaded;
+// otherwise errEventModified is returned.
+func applyEventUpdate(tx *gorm.DB, c *fiber.Ctx, event *Event, updateData map[string]interface{}, action string) error {
+	before := *event
+	if err := ensureBaselineRevision(tx, &before); err != nil {
+		return err
+	}
+	if err := checkUnchanged(tx, &before); err != nil {
+		return err
+	}
+	if externalID, ok := updateData["external_id"].(*string); ok {
+		if err := checkExternalIDFree(tx, externalID, event.ID); err != nil {
+			return err
+		}
+	}
+	if err := tx.Model(event).Updates(updateData).Error; err != nil {
+		return err
+	}
+	// Reload the stored row so the revision and the audit diff reflect what was actually written
+	if err := tx.First(event, before.ID).Error; err != nil {
+		return err
+	}
+	return recordRevision(tx, c, event, action)
+}
+
+// updateEvent runs applyEventUpdate in its own transaction, then writes the
+// audit entry. PUT, PATCH and revision restores all go through here. Dry runs
+// are rolled back and not audited; event then holds the would-be result.
+func updateEvent(c *fiber.Ctx, db *gorm.DB, lang string, event *Event, updateData map[string]interface{}, action string) error {
+	before := *event
+	err := writeTransaction(c, db, func(tx *gorm.DB) error {
+		return applyEventUpdate(tx, c, event, updateData, action)
+	})
+	if err != nil || isDryRun(c) {
+		return err
+	}
+	writeAudit(newAuditEntry(c, action, lang, &before, event))
+	return nil
+}
+
+// findRevision loads a revision of the event named by the :id route parameter.
+// When it returns nil, the error response has been written and err is the
+// result of writing it.
+func findRevision(c *fiber.Ctx, db *gorm.DB, handler, lang, eventParam, revisionParam string) (*EventRevision, error) {
+	eventID, err := strconv.ParseUint(eventParam, 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
+	}
+	number, err := strconv.Atoi(revisionParam)
+	if err != nil || number < 1 {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid revision number"})
+	}
+	var revision EventRevision
+	if err := db.Where("event_id = ? AND revision = ?", uint(eventID), number).First(&revision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": fmt.Sprintf("Revision %d not found", number)})
+		}
+		zlog.Error().Uint64("event_id", eventID).Int("revision", number).Str("lang", lang).Err(err).Msg(handler + ": Failed to retrieve revision")
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve revision"})
+	}
+	return &revision, nil
+}
+
+// Handler for GET /api/events/{id}/revisions
+// Lists the revisions of an event, newest first.
+func getEventRevisionsHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	eventID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
+	}
+	page, limit, offset := parsePagination(c)
+
+	query := db.Model(&EventRevision{}).Where("event_id = ?", uint(eventID))
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		zlog.Error().Uint64("event_id", eventID).Str("lang", lang).Err(err).Msg("getEventRevisionsHandler: Failed to count revisions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve revisions"})
+	}
+	if total == 0 {
+		// Events that were never changed have no revisions yet
+		var count int64
+		if err := db.Model(&Event{}).Where("id = ?", uint(eventID)).Count(&count).Error; err != nil || count == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
+		}
+	}
+	revisions := []EventRevision{}
+	if err := query.Order("revision desc").Limit(limit).Offset(offset).Find(&revisions).Error; err != nil {
+		zlog.Error().Uint64("event_id", eventID).Str("lang", lang).Err(err).Msg("getEventRevisionsHandler: Failed to retrieve revisions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve revisions"})
+	}
+
+	return c.JSON(fiber.Map{
+		"data":       revisions,
+		"pagination": newPaginationData(page, limit, total),
+	})
+}
+
+// Handler for GET /api/events/{id}/revisions/{revision}
+// Returns a single revision with its full snapshot.
+func getEventRevisionHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	revision, err := findRevision(c, db, "getEventRevisionHandler", lang, c.Params("id"), c.Params("revision"))
+	if revision == nil {
+		return err
+	}
+	return c.JSON(fiber.Map{"data": revision})
+}
+
+// Handler for GET /api/events/{id}/revisions/diff?from=&to=
+// Returns the fields that changed between two revisions of an event.
+func getEventRevisionDiffHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	if c.Query("from") == "" || c.Query("to") == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Both 'from' and 'to' revisions are required"})
+	}
+	from, err := findRevision(c, db, "getEventRevisionDiffHandler", lang, c.Params("id"), c.Query("from"))
+	if from == nil {
+		return err
+	}
+	to, err := findRevision(c, db, "getEventRevisionDiffHandler", lang, c.Params("id"), c.Query("to"))
+	if to == nil {
+		return err
+	}
+
+	diff, err := diffEvents((*Event)(&from.Snapshot), (*Event)(&to.Snapshot))
+	if err != nil {
+		zlog.Error().Uint("event_id", from.EventID).Str("lang", lang).Err(err).Msg("getEventRevisionDiffHandler: Failed to diff revisions")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to diff revisions"})
+	}
+	return c.JSON(fiber.Map{"data": fiber.Map{
+		"event_id": from.EventID,
+		"from":     from.Revision,
+		"to":       to.Revision,
+		"diff":     diff,
+	}})
+}
+
+// Handler for POST /api/events/{id}/revisions/{revision}/restore
+// Writes the content of an earlier revision back to the event as a new revision.
+func restoreEventRevisionHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	revision, err := findRevision(c, db, "restoreEventRevisionHandler", lang, c.Params("id"), c.Params("revision"))
+	if revision == nil {
+		return err
+	}
+
+	var event Event
+	if err := db.First(&event, revision.EventID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+
+	if err := updateEvent(c, db, lang, &event, eventUpdateData((*Event)(&revision.Snapshot)), auditRestore); err != nil {
+		var conflict *eventConflictError
+		if errors.As(err, &conflict) {
+			return c.Status(fiber.StatusConflict).JSON(conflict.response())
+		}
+		if errors.Is(err, errEventModified) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "Event was modified during the restore, retry"})
+		}
+		zlog.Error().Uint("event_id", event.ID).Int("revision", revision.Revision).Str("lang", lang).Err(err).Msg("restoreEventRevisionHandler: Failed to restore revision")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore revision"})
+	}
+
+	zlog.Info().Uint("event_id", event.ID).Int("revision", revision.Revision).Str("lang", lang).Msg("restoreEventRevisionHandler: Revision restored")
+	return c.JSON(withDryRun(c, fiber.Map{"data": event, "restored_revision": revision.Revision}))
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestEventRevisions(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events", createEventHandler)
+	api.Patch("/events/:id", patchEventHandler)
+	api.Get("/events/:id/revisions", getEventRevisionsHandler)
+	api.Get("/events/:id/revisions/diff", getEventRevisionDiffHandler)
+	api.Get("/events/:id/revisions/:revision", getEventRevisionHandler)
+	api.Post("/events/:id/revisions/:revision/restore", restoreEventRevisionHandler)
+
+	var list struct {
+		Data []EventRevision `json:"data"`
+	}
+
+	// 1. Creating and updating an event stores a revision per write
+	if status := api.do(http.MethodPost, "/api/events", `{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "description": "First block"}`, nil); status != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %d", status)
+	}
+	for _, description := range []string{"The genesis block", "The genesis block is mined"} {
+		if status := api.do(http.MethodPatch, "/api/events/1", `{"description": "`+description+`"}`, nil); status != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %d", status)
+		}
+	}
+	if status := api.do(http.MethodGet, "/api/events/1/revisions", "", &list); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if len(list.Data) != 3 || list.Data[0].Revision != 3 || list.Data[2].Action != auditCreate {
+		t.Fatalf("expected 3 revisions newest first, got %+v", list.Data)
+	}
+	if list.Data[2].Snapshot.Description != "First block" {
+		t.Fatalf("expected the original description in revision 1, got %q", list.Data[2].Snapshot.Description)
+	}
+
+	// 2. Diff between two revisions
+	var diff struct {
+		Data struct {
+			Diff AuditDiff `json:"diff"`
+		} `json:"data"`
+	}
+	if status := api.do(http.MethodGet, "/api/events/1/revisions/diff?from=1&to=3", "", &diff); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if change := diff.Data.Diff["description"]; len(diff.Data.Diff) != 1 || change.Before != "First block" || change.After != "The genesis block is mined" {
+		t.Fatalf("expected only the description to differ, got %v", diff.Data.Diff)
+	}
+
+	// 3. Restoring writes the old content back as a new revision
+	var restored struct {
+		Data Event `json:"data"`
+	}
+	if status := api.do(http.MethodPost, "/api/events/1/revisions/1/restore", "", &restored); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if restored.Data.Description != "First block" {
+		t.Fatalf("expected the description of revision 1, got %q", restored.Data.Description)
+	}
+	var revision struct {
+		Data EventRevision `json:"data"`
+	}
+	if status := api.do(http.MethodGet, "/api/events/1/revisions/4", "", &revision); status != http.StatusOK || revision.Data.Action != auditRestore {
+		t.Fatalf("expected restore revision 4, got %d %+v", status, revision.Data)
+	}
+
+	// 4. Events created before revisions existed get a baseline on their first update
+	legacy := Event{Title: "Pizza day", Date: time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC), Description: "Two pizzas"}
+	if err := db.Create(&legacy).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	if status := api.do(http.MethodPatch, "/api/events/2", `{"description": "10,000 BTC for two pizzas"}`, nil); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	api.do(http.MethodGet, "/api/events/2/revisions", "", &list)
+	if len(list.Data) != 2 || list.Data[1].Action != revisionBaseline || list.Data[1].Snapshot.Description != "Two pizzas" {
+		t.Fatalf("expected a baseline and an update revision, got %+v", list.Data)
+	}
+
+	// 5. Snapshots of events with references stored before validation stay readable
+	if err := db.Exec(`INSERT INTO events (title, date, tags, media, "references") VALUES (?, ?, '[]', '[]', ?)`,
+		"Hal receives bitcoin", time.Date(2009, 1, 12, 0, 0, 0, 0, time.UTC), `[{"url": ""}]`).Error; err != nil {
+		t.Fatalf("failed to insert event: %v", err)
+	}
+	if status := api.do(http.MethodPatch, "/api/events/3", `{"description": "First transaction"}`, nil); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if status := api.do(http.MethodGet, "/api/events/3/revisions", "", &list); status != http.StatusOK || len(list.Data) != 2 {
+		t.Fatalf("expected 200 OK with 2 revisions, got %d %+v", status, list.Data)
+	}
+	if refs := list.Data[1].Snapshot.References; len(refs) != 1 || refs[0].URL != "" {
+		t.Fatalf("expected the stored reference in the baseline, got %+v", refs)
+	}
+	if status := api.do(http.MethodGet, "/api/events/3/revisions/1", "", &revision); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if status := api.do(http.MethodPost, "/api/events/3/revisions/1/restore", "", &restored); status != http.StatusOK || restored.Data.Description != "" {
+		t.Fatalf("expected the baseline to be restored, got %d %+v", status, restored.Data)
+	}
+
+	// 6. Errors
+	if status := api.do(http.MethodGet, "/api/events/1/revisions/9", "", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing revision, got %d", status)
+	}
+	if status := api.do(http.MethodGet, "/api/events/99/revisions", "", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing event, got %d", status)
+	}
+	if status := api.do(http.MethodGet, "/api/events/1/revisions/diff?from=1", "", nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 without 'to', got %d", status)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Tag is a normalized (trimmed, lowercased) tag name
+type Tag struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"size:255;not null;uniqueIndex:idx_tags_name"`
+}
+
+// EventTag links an event to one of its tags. The links are derived from the
+// events.tags JSON array by triggers, so the public JSON shape stays the same.
+type EventTag struct {
+	EventID uint `gorm:"primaryKey;autoIncrement:false"`
+	TagID   uint `gorm:"primaryKey;autoIncrement:false;index:idx_event_tags_tag_id"`
+}
+
+// TagAlias maps an alternative tag name to its canonical tag. Aliases are
+// resolved when events are queried by tag, e.g. "ln" finds events tagged "lightning".
+type TagAlias struct {
+	Alias     string    `json:"alias" gorm:"primaryKey;size:255"`
+	Tag       string    `json:"tag" gorm:"size:255;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// normalizeTag matches the LOWER(TRIM(...)) normalization applied in SQL,
+// which only trims spaces and lowercases ASCII letters.
+func normalizeTag(tag string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, strings.Trim(tag, " "))
+}
+
+// eventTagsJSONEach expands the tags JSON array of the events row aliased as
+// alias into a json_each table named j. Values that are not a JSON array expand
+// to nothing; eventTagFilter additionally skips non-string items and blank tags.
+func eventTagsJSONEach(alias string) string {
+	return fmt.Sprintf(`json_each(
+		CASE WHEN json_valid(%[1]s.tags)
+			THEN CASE WHEN json_type(%[1]s.tags) = 'array' THEN %[1]s.tags ELSE '[]' END
+			ELSE '[]'
+		END
+	) j`, alias)
+}
+
+const (
+	eventTagFilter = "j.type = 'text' AND TRIM(j.value) != ''"
+	eventTagName   = "LOWER(TRIM(j.value))"
+)
+
+// linkEventTagsSQL creates the tags and event_tags rows for the events rows
+// selected by from, where alias is the name of the events row in from.
+func linkEventTagsSQL(from, alias string) string {
+	return fmt.Sprintf(`
+		INSERT OR IGNORE INTO tags(name)
+		SELECT DISTINCT %[1]s FROM %[2]s WHERE %[3]s;
+		INSERT OR IGNORE INTO event_tags(event_id, tag_id)
+		SELECT DISTINCT %[4]s.id, t.id FROM %[2]s JOIN tags t ON t.name = %[1]s WHERE %[3]s;`,
+		eventTagName, from, eventTagFilter, alias)
+}
+
+// initTagTables creates the normalized tag tables, the triggers that keep them
+// synchronized with events.tags, and migrates the tags of existing events.
+func initTagTables(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Tag{}, &EventTag{}, &TagAlias{}); err != nil {
+		return err
+	}
+
+	if err := db.Exec(`
+		CREATE TRIGGER IF NOT EXISTS events_tags_after_insert
+		AFTER INSERT ON events
+		BEGIN` + linkEventTagsSQL(eventTagsJSONEach("new"), "new") + `
+		END;
+	`).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(`
+		CREATE TRIGGER IF NOT EXISTS events_tags_after_update
+		AFTER UPDATE OF tags ON events
+		BEGIN
+			DELETE FROM event_tags WHERE event_id = old.id;` + linkEventTagsSQL(eventTagsJSONEach("new"), "new") + `
+		END;
+	`).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(`
+		CREATE TRIGGER IF NOT EXISTS events_tags_after_delete
+		AFTER DELETE ON events
+		BEGIN
+			DELETE FROM event_tags WHERE event_id = old.id;
+		END;
+	`).Error; err != nil {
+		return err
+	}
+
+	// Initial population from the JSON tags of existing events
+	var linkCount int64
+	if err := db.Model(&EventTag{}).Count(&linkCount).Error; err != nil {
+		return err
+	}
+	if linkCount == 0 {
+		if err := db.Exec(linkEventTagsSQL("events e, "+eventTagsJSONEach("e"), "e")).Error; err != nil {
+			return err
+		}
+	}
+
+	// The LIKE-based tag filtering that used idx_events_tags is superseded by event_tags
+	return db.Exec("DROP INDEX IF EXISTS idx_events_tags").Error
+}
+
+// withTag restricts an events query to events carrying the given tag (case-insensitive).
+// Tag aliases are resolved to their canonical tag first. The lookup goes through
+// the unique tag name index and the event_tags table.
+func withTag(tag string) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(`events.id IN (
+			SELECT et.event_id FROM event_tags et JOIN tags t ON t.id = et.tag_id
+			WHERE t.name = COALESCE((SELECT a.tag FROM tag_aliases a WHERE a.alias = LOWER(TRIM(@tag))), LOWER(TRIM(@tag)))
+		)`, sql.Named("tag", tag))
+	}
+}
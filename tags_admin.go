@@ -0,0 +1,343 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// tagAdminError is a client error detected while running a tag admin operation.
+// It rolls back the transaction and is reported with its status code.
+type tagAdminError struct {
+	status  int
+	message string
+}
+
+func (e *tagAdminError) Error() string { return e.message }
+
+// TagRewriteResult reports the effect of a tag rename, merge or delete on one language
+type TagRewriteResult struct {
+	EventsUpdated  int64 `json:"events_updated"`
+	AliasesUpdated int64 `json:"aliases_updated"`
+
+	changes [][2]Event // Tags of every updated event before and after
+}
+
+// auditEntries describes the updated events for the audit log
+func (r TagRewriteResult) auditEntries(c *fiber.Ctx, action, lang string) []AuditEntry {
+	entries := make([]AuditEntry, 0, len(r.changes))
+	for _, change := range r.changes {
+		entries = append(entries, newAuditEntry(c, action, lang, &change[0], &change[1]))
+	}
+	return entries
+}
+
+// recordRevisions stores a revision of every updated event
+func (r TagRewriteResult) recordRevisions(tx *gorm.DB, c *fiber.Ctx, action string) error {
+	for i := range r.changes {
+		if err := ensureBaselineRevision(tx, &r.changes[i][0]); err != nil {
+			return err
+		}
+		if err := recordRevision(tx, c, &r.changes[i][1], action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagAdminLanguages returns the languages a tag admin request applies to: the
+// request language, or every language with ?all_languages=true
+func tagAdminLanguages(c *fiber.Ctx) []string {
+	if c.QueryBool("all_languages") {
+		return availableLanguages()
+	}
+	lang, _ := requestLanguage(c)
+	return []string{lang}
+}
+
+// runTagAdminOperation runs op in one transaction per target language database
+// and responds with the results keyed by language. Languages are processed in
+// order; on failure the failing language is rolled back, already committed
+// languages are reported alongside the error. The audit entries returned by op
+// are recorded once its transaction is committed.
+func runTagAdminOperation(c *fiber.Ctx, handler string, op func(lang string, tx *gorm.DB) (interface{}, []AuditEntry, error)) error {
+	results := fiber.Map{}
+	for _, lang := range tagAdminLanguages(c) {
+		var result interface{}
+		var audit []AuditEntry
+		err := languageDBs[lang].Transaction(func(tx *gorm.DB) error {
+			var err error
+			result, audit, err = op(lang, tx)
+			return err
+		})
+		if err != nil {
+			var adminErr *tagAdminError
+			if errors.As(err, &adminErr) {
+				zlog.Warn().Str("lang", lang).Err(err).Msg(handler + ": Rejected")
+				return c.Status(adminErr.status).JSON(fiber.Map{"error": adminErr.message, "lang": lang, "data": results})
+			}
+			zlog.Error().Str("lang", lang).Err(err).Msg(handler + ": Transaction failed")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to update tags", "lang": lang, "data": results})
+		}
+		writeAudit(audit...)
+		results[lang] = result
+	}
+	zlog.Info().Int("language_count", len(results)).Msg(handler + ": Successfully applied")
+	return c.JSON(fiber.Map{"data": results})
+}
+
+// rewriteEventTags replaces the sources tags with target in the tags of every
+// event carrying one of them, or removes them when target is empty. Aliases
+// pointing at a source are moved to target, or removed along with the tag.
+// A target that is an alias is resolved to its canonical tag, as events
+// carrying the alias itself could not be found by tag.
+// The event_tags links follow through the events.tags triggers.
+func rewriteEventTags(tx *gorm.DB, sources []string, target string) (TagRewriteResult, error) {
+	var result TagRewriteResult
+
+	if target != "" {
+		var alias TagAlias
+		err := tx.Where("alias = ?", target).First(&alias).Error
+		if err == nil {
+			if slices.Contains(sources, alias.Tag) {
+				return result, &tagAdminError{fiber.StatusConflict, fmt.Sprintf("'%s' is an alias of '%s'", target, alias.Tag)}
+			}
+			target = alias.Tag
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return result, err
+		}
+	}
+
+	var events []Event
+	// Full rows are loaded, as the updated events are stored as revisions.
+	// Trashed events are rewritten too, so they come back with current tags.
+	if err := tx.Unscoped().
+		Where("events.id IN (SELECT et.event_id FROM event_tags et JOIN tags t ON t.id = et.tag_id WHERE t.name IN ?)", sources).
+		Find(&events).Error; err != nil {
+		return result, err
+	}
+
+	for _, event := range events {
+		before := event
+		tags := StringList{}
+		seen := map[string]bool{}
+		for _, tag := range event.Tags {
+			name := normalizeTag(tag)
+			if slices.Contains(sources, name) {
+				if target == "" {
+					continue
+				}
+				tag, name = target, target
+			}
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			tags = append(tags, tag)
+		}
+		if err := tx.Unscoped().Model(&event).Update("tags", tags).Error; err != nil {
+			return result, err
+		}
+		event.Tags = tags
+		result.EventsUpdated++
+		result.changes = append(result.changes, [2]Event{before, event})
+	}
+
+	aliases := tx.Model(&TagAlias{}).Where("tag IN ?", sources)
+	if target == "" {
+		aliases = aliases.Delete(&TagAlias{})
+	} else {
+		aliases = aliases.Update("tag", target)
+	}
+	if aliases.Error != nil {
+		return result, aliases.Error
+	}
+	result.AliasesUpdated = aliases.RowsAffected
+
+	// Drop tag rows that no event uses anymore so /api/tags stays clean
+	if err := tx.Exec("DELETE FROM tags WHERE name IN ? AND id NOT IN (SELECT tag_id FROM event_tags)", sources).Error; err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// tagRewriteOperation returns the runTagAdminOperation op of a tag rename,
+// merge or delete, recording a revision and an audit entry of every updated event
+func tagRewriteOperation(c *fiber.Ctx, sources []string, target, action string) func(string, *gorm.DB) (interface{}, []AuditEntry, error) {
+	return func(lang string, tx *gorm.DB) (interface{}, []AuditEntry, error) {
+		result, err := rewriteEventTags(tx, sources, target)
+		if err == nil {
+			err = result.recordRevisions(tx, c, action)
+		}
+		return result, result.auditEntries(c, action, lang), err
+	}
+}
+
+// TagRenameRequest is the body of POST /api/admin/tags/rename
+type TagRenameRequest struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Handler for POST /api/admin/tags/rename
+// Renames a tag on every event carrying it.
+func renameTagHandler(c *fiber.Ctx) error {
+	var req TagRenameRequest
+	if err := c.BodyParser(&req); err != nil {
+		zlog.Warn().Err(err).Msg("renameTagHandler: Cannot parse JSON")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	from, to := normalizeTag(req.From), normalizeTag(req.To)
+	if from == "" || to == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Both 'from' and 'to' are required"})
+	}
+	if from == to {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "'from' and 'to' must be different tags"})
+	}
+
+	zlog.Info().Str("from", from).Str("to", to).Msg("renameTagHandler called")
+	return runTagAdminOperation(c, "renameTagHandler", tagRewriteOperation(c, []string{from}, to, auditTagRename))
+}
+
+// TagMergeRequest is the body of POST /api/admin/tags/merge
+type TagMergeRequest struct {
+	Sources []string `json:"sources"`
+	Target  string   `json:"target"`
+}
+
+// Handler for POST /api/admin/tags/merge
+// Replaces several tags with a single target tag on every event.
+func mergeTagsHandler(c *fiber.Ctx) error {
+	var req TagMergeRequest
+	if err := c.BodyParser(&req); err != nil {
+		zlog.Warn().Err(err).Msg("mergeTagsHandler: Cannot parse JSON")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	target := normalizeTag(req.Target)
+	if target == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "'target' is required"})
+	}
+	var sources []string
+	for _, source := range req.Sources {
+		source = normalizeTag(source)
+		if source != "" && source != target && !slices.Contains(sources, source) {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "'sources' must list at least one tag other than the target"})
+	}
+
+	zlog.Info().Strs("sources", sources).Str("target", target).Msg("mergeTagsHandler called")
+	return runTagAdminOperation(c, "mergeTagsHandler", tagRewriteOperation(c, sources, target, auditTagMerge))
+}
+
+// Handler for DELETE /api/admin/tags/{tag}
+// Removes a tag from every event, along with the aliases pointing at it.
+func deleteTagHandler(c *fiber.Ctx) error {
+	tagParam, err := url.PathUnescape(c.Params("tag"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid tag"})
+	}
+	tag := normalizeTag(tagParam)
+	if tag == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Tag parameter is required"})
+	}
+
+	zlog.Info().Str("tag", tag).Msg("deleteTagHandler called")
+	return runTagAdminOperation(c, "deleteTagHandler", tagRewriteOperation(c, []string{tag}, "", auditTagDelete))
+}
+
+// Handler for GET /api/admin/tags/aliases
+// Lists the tag aliases of the request language.
+func getTagAliasesHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	zlog.Info().Str("lang", lang).Msg("getTagAliasesHandler called")
+
+	var aliases []TagAlias
+	if err := db.Order("alias asc").Find(&aliases).Error; err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("getTagAliasesHandler: Failed to retrieve aliases")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve tag aliases"})
+	}
+	return c.JSON(fiber.Map{"data": aliases})
+}
+
+// TagAliasRequest is the body of PUT /api/admin/tags/aliases/{alias}
+type TagAliasRequest struct {
+	Tag string `json:"tag"`
+}
+
+// Handler for PUT /api/admin/tags/aliases/{alias}
+// Creates or repoints an alias. The alias must not be a tag still used by
+// events (merge it first), and aliases cannot point at other aliases.
+func putTagAliasHandler(c *fiber.Ctx) error {
+	aliasParam, err := url.PathUnescape(c.Params("alias"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid alias"})
+	}
+	var req TagAliasRequest
+	if err := c.BodyParser(&req); err != nil {
+		zlog.Warn().Err(err).Msg("putTagAliasHandler: Cannot parse JSON")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Cannot parse JSON"})
+	}
+	alias, tag := normalizeTag(aliasParam), normalizeTag(req.Tag)
+	if alias == "" || tag == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Both the alias and 'tag' are required"})
+	}
+	if alias == tag {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "An alias cannot point at itself"})
+	}
+
+	zlog.Info().Str("alias", alias).Str("tag", tag).Msg("putTagAliasHandler called")
+	return runTagAdminOperation(c, "putTagAliasHandler", func(_ string, tx *gorm.DB) (interface{}, []AuditEntry, error) {
+		var used int64
+		if err := tx.Model(&EventTag{}).
+			Joins("JOIN tags t ON t.id = event_tags.tag_id").
+			Where("t.name = ?", alias).
+			Count(&used).Error; err != nil {
+			return nil, nil, err
+		}
+		if used > 0 {
+			return nil, nil, &tagAdminError{fiber.StatusConflict, fmt.Sprintf("'%s' is used by %d events; merge it into '%s' first", alias, used, tag)}
+		}
+
+		var chained int64
+		if err := tx.Model(&TagAlias{}).Where("alias = ? OR tag = ?", tag, alias).Count(&chained).Error; err != nil {
+			return nil, nil, err
+		}
+		if chained > 0 {
+			return nil, nil, &tagAdminError{fiber.StatusBadRequest, "Aliases cannot point at other aliases"}
+		}
+
+		var tagAlias TagAlias
+		err := tx.Where("alias = ?", alias).First(&tagAlias).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			tagAlias = TagAlias{Alias: alias, Tag: tag}
+			err = tx.Create(&tagAlias).Error
+		} else if err == nil {
+			tagAlias.Tag = tag
+			err = tx.Model(&tagAlias).Update("tag", tag).Error
+		}
+		return tagAlias, nil, err
+	})
+}
+
+// Handler for DELETE /api/admin/tags/aliases/{alias}
+func deleteTagAliasHandler(c *fiber.Ctx) error {
+	aliasParam, err := url.PathUnescape(c.Params("alias"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid alias"})
+	}
+	alias := normalizeTag(aliasParam)
+
+	zlog.Info().Str("alias", alias).Msg("deleteTagAliasHandler called")
+	return runTagAdminOperation(c, "deleteTagAliasHandler", func(_ string, tx *gorm.DB) (interface{}, []AuditEntry, error) {
+		res := tx.Where("alias = ?", alias).Delete(&TagAlias{})
+		return fiber.Map{"deleted": res.RowsAffected > 0}, nil, res.Error
+	})
+}
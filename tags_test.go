@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+func countTagged(t *testing.T, db *gorm.DB, tag string) int64 {
+	var count int64
+	if err := db.Model(&Event{}).Scopes(withTag(tag)).Count(&count).Error; err != nil {
+		t.Fatalf("failed to count events tagged %q: %v", tag, err)
+	}
+	return count
+}
+
+func TestTagTablesFollowEventTags(t *testing.T) {
+	db := openTestDB(t)
+	date := time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)
+
+	// Existing rows are migrated when the tables are created.
+	existing := []Event{{Title: "Pizza", Date: date, Tags: StringList{"first", "Adoption ", "first"}}}
+	if err := db.Create(&existing).Error; err != nil {
+		t.Fatalf("failed to create events: %v", err)
+	}
+	// Legacy rows may hold values that are not a JSON array of strings.
+	for _, tags := range []string{`not json`, `{"tag": "first"}`, `[1, "", null]`} {
+		if err := db.Exec("INSERT INTO events (date, title, tags) VALUES (?, ?, ?)", date, "Legacy", tags).Error; err != nil {
+			t.Fatalf("failed to insert legacy event: %v", err)
+		}
+	}
+	if err := initTagTables(db); err != nil {
+		t.Fatalf("initTagTables failed: %v", err)
+	}
+	if got := countTagged(t, db, "first"); got != 1 {
+		t.Fatalf("expected 1 event tagged 'first', got %d", got)
+	}
+	if got := countTagged(t, db, "ADOPTION"); got != 1 {
+		t.Fatalf("expected 1 event tagged 'adoption', got %d", got)
+	}
+
+	// Inserts, updates and deletes are kept in sync by triggers.
+	quoted := Event{Title: "Quoted", Date: date, Tags: StringList{`say "hi"`, "first"}}
+	if err := db.Create(&quoted).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	if got := countTagged(t, db, `say "hi"`); got != 1 {
+		t.Fatalf("expected 1 event tagged with a quoted tag, got %d", got)
+	}
+	if got := countTagged(t, db, "first"); got != 2 {
+		t.Fatalf("expected 2 events tagged 'first', got %d", got)
+	}
+
+	if err := db.Model(&existing[0]).Update("tags", StringList{"lightning"}).Error; err != nil {
+		t.Fatalf("failed to update event: %v", err)
+	}
+	if got := countTagged(t, db, "first"); got != 1 {
+		t.Fatalf("expected 1 event tagged 'first' after update, got %d", got)
+	}
+	if got := countTagged(t, db, "lightning"); got != 1 {
+		t.Fatalf("expected 1 event tagged 'lightning' after update, got %d", got)
+	}
+
+	if err := db.Delete(&quoted).Error; err != nil {
+		t.Fatalf("failed to delete event: %v", err)
+	}
+	if got := countTagged(t, db, "first"); got != 0 {
+		t.Fatalf("expected no event tagged 'first' after delete, got %d", got)
+	}
+}
+
+func TestRewriteEventTagsAndAliases(t *testing.T) {
+	db := openTestDB(t)
+	if err := initTagTables(db); err != nil {
+		t.Fatalf("initTagTables failed: %v", err)
+	}
+	date := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Title: "LN launch", Date: date, Tags: StringList{"Lightning", "ln"}},
+		{Title: "Whitepaper", Date: date, Tags: StringList{"lightning network", "paper"}},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("failed to create events: %v", err)
+	}
+
+	result, err := rewriteEventTags(db, []string{"lightning", "ln"}, "lightning network")
+	if err != nil {
+		t.Fatalf("merge failed: %v", err)
+	}
+	if result.EventsUpdated != 1 {
+		t.Fatalf("expected 1 updated event, got %d", result.EventsUpdated)
+	}
+	var merged Event
+	if err := db.First(&merged, events[0].ID).Error; err != nil {
+		t.Fatalf("failed to reload event: %v", err)
+	}
+	if len(merged.Tags) != 1 || merged.Tags[0] != "lightning network" {
+		t.Fatalf("expected merged tags to be deduplicated, got %v", merged.Tags)
+	}
+	if got := countTagged(t, db, "lightning network"); got != 2 {
+		t.Fatalf("expected 2 events tagged 'lightning network', got %d", got)
+	}
+
+	// Aliases are resolved at query time
+	if err := db.Create(&TagAlias{Alias: "ln", Tag: "lightning network"}).Error; err != nil {
+		t.Fatalf("failed to create alias: %v", err)
+	}
+	if got := countTagged(t, db, " LN"); got != 2 {
+		t.Fatalf("expected alias 'ln' to find 2 events, got %d", got)
+	}
+
+	// A target that is an alias is resolved to its canonical tag
+	if err := db.Create(&Event{Title: "Channels", Date: date, Tags: StringList{"channels"}}).Error; err != nil {
+		t.Fatalf("failed to create event: %v", err)
+	}
+	if _, err := rewriteEventTags(db, []string{"channels"}, "ln"); err != nil {
+		t.Fatalf("rename into an alias failed: %v", err)
+	}
+	if got := countTagged(t, db, "ln"); got != 3 {
+		t.Fatalf("expected alias 'ln' to find 3 events after the rename, got %d", got)
+	}
+	var adminErr *tagAdminError
+	if _, err := rewriteEventTags(db, []string{"lightning network"}, "ln"); !errors.As(err, &adminErr) || adminErr.status != fiber.StatusConflict {
+		t.Fatalf("expected 409 for a rename into its own alias, got %v", err)
+	}
+
+	// Deleting the tag removes it from events and drops its aliases
+	result, err = rewriteEventTags(db, []string{"lightning network"}, "")
+	if err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if result.EventsUpdated != 3 || result.AliasesUpdated != 1 {
+		t.Fatalf("expected 3 events and 1 alias updated, got %+v", result)
+	}
+	if got := countTagged(t, db, "ln"); got != 0 {
+		t.Fatalf("expected no event tagged 'ln' after delete, got %d", got)
+	}
+	if got := countTagged(t, db, "paper"); got != 1 {
+		t.Fatalf("expected unrelated tags to be kept, got %d events tagged 'paper'", got)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// Handler for /api/events/{id}/translations
+// Returns every language variant of an event, found through its translation group.
+func getEventTranslationsHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	id := c.Params("id")
+
+	zlog.Info().Str("id", id).Str("lang", lang).Msg("getEventTranslationsHandler called")
+
+	eventID, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		zlog.Warn().Str("id", id).Str("lang", lang).Err(err).Msg("getEventTranslationsHandler: Invalid Event ID format")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid Event ID format",
+		})
+	}
+
+	var event Event
+	if err := db.First(&event, uint(eventID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found"})
+		}
+		zlog.Error().Str("id", id).Str("lang", lang).Err(err).Msg("getEventTranslationsHandler: Failed to retrieve event")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve event"})
+	}
+
+	variants := map[string]Event{lang: event}
+	if event.TranslationGroup != "" {
+		for otherLang, otherDB := range languageDBs {
+			if otherLang == lang {
+				continue
+			}
+			var variant Event
+			err := otherDB.Where("translation_group = ?", event.TranslationGroup).First(&variant).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				continue
+			}
+			if err != nil {
+				zlog.Error().Str("id", id).Str("lang", otherLang).Str("translation_group", event.TranslationGroup).Err(err).Msg("getEventTranslationsHandler: Failed to retrieve translation")
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve translations"})
+			}
+			variants[otherLang] = variant
+		}
+	}
+
+	missing := []string{}
+	for _, l := range availableLanguages() {
+		if _, ok := variants[l]; !ok {
+			missing = append(missing, l)
+		}
+	}
+
+	zlog.Info().Str("id", id).Str("lang", lang).Int("variant_count", len(variants)).Msg("getEventTranslationsHandler: Successfully retrieved translations")
+	return c.JSON(fiber.Map{
+		"translation_group": event.TranslationGroup,
+		"data":              variants,
+		"missing_languages": missing,
+	})
+}
+
+// MissingTranslation describes a translation group that has no event in a language
+type MissingTranslation struct {
+	TranslationGroup string          `json:"translation_group"`
+	Date             time.Time       `json:"date"`
+	Title            string          `json:"title"`
+	AvailableIn      map[string]uint `json:"available_in"` // Language -> event ID
+}
+
+// LanguageCoverage is the per-language entry of the translation coverage report
+type LanguageCoverage struct {
+	Lang         string               `json:"lang"`
+	Translated   int                  `json:"translated"`    // Translation groups present in this language
+	MissingCount int                  `json:"missing_count"` // Translation groups absent from this language
+	Unlinked     int64                `json:"unlinked"`      // Events without a translation group
+	Missing      []MissingTranslation `json:"missing"`
+}
+
+// Handler for /api/translations/coverage
+// Lists, for every language, the translation groups that exist in other
+// languages but have no event in this one, so translators know what to work on.
+func getTranslationCoverageHandler(c *fiber.Ctx) error {
+	zlog.Info().Msg("getTranslationCoverageHandler called")
+
+	langs := availableLanguages()
+	groups := map[string]map[string]Event{} // Translation group -> language -> event
+	unlinked := map[string]int64{}
+
+	for _, lang := range langs {
+		db := languageDBs[lang]
+
+		var events []Event
+		if err := db.Select("id", "date", "title", "translation_group").
+			Where("translation_group IS NOT NULL AND translation_group != ''").
+			Find(&events).Error; err != nil {
+			zlog.Error().Str("lang", lang).Err(err).Msg("getTranslationCoverageHandler: Failed to retrieve translation groups")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve translation groups"})
+		}
+		for _, event := range events {
+			if groups[event.TranslationGroup] == nil {
+				groups[event.TranslationGroup] = map[string]Event{}
+			}
+			groups[event.TranslationGroup][lang] = event
+		}
+
+		var count int64
+		if err := db.Model(&Event{}).
+			Where("translation_group IS NULL OR translation_group = ''").
+			Count(&count).Error; err != nil {
+			zlog.Error().Str("lang", lang).Err(err).Msg("getTranslationCoverageHandler: Failed to count unlinked events")
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to count unlinked events"})
+		}
+		unlinked[lang] = count
+	}
+
+	report := make([]LanguageCoverage, 0, len(langs))
+	for _, lang := range langs {
+		coverage := LanguageCoverage{Lang: lang, Unlinked: unlinked[lang], Missing: []MissingTranslation{}}
+		for group, variants := range groups {
+			if _, ok := variants[lang]; ok {
+				coverage.Translated++
+				continue
+			}
+
+			// Describe the missing event with its default language variant when there is one
+			missing := MissingTranslation{TranslationGroup: group, AvailableIn: map[string]uint{}}
+			for _, l := range langs {
+				variant, ok := variants[l]
+				if !ok {
+					continue
+				}
+				missing.AvailableIn[l] = variant.ID
+				if missing.Title == "" || l == defaultLanguage {
+					missing.Title = variant.Title
+					missing.Date = variant.Date
+				}
+			}
+			coverage.Missing = append(coverage.Missing, missing)
+		}
+		sort.Slice(coverage.Missing, func(i, j int) bool {
+			a, b := coverage.Missing[i], coverage.Missing[j]
+			if !a.Date.Equal(b.Date) {
+				return a.Date.Before(b.Date)
+			}
+			return a.TranslationGroup < b.TranslationGroup
+		})
+		coverage.MissingCount = len(coverage.Missing)
+		report = append(report, coverage)
+	}
+
+	zlog.Info().Int("group_count", len(groups)).Msg("getTranslationCoverageHandler: Successfully built coverage report")
+	return c.JSON(fiber.Map{
+		"languages":    langs,
+		"total_groups": len(groups),
+		"data":         report,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// newTranslationTestAPI registers en, ru and es databases, with the genesis
+// block translated everywhere, the pizza day missing in es, the halving only in
+// ru, and one unlinked event in en
+func newTranslationTestAPI(t *testing.T) *testAPI {
+	genesis := time.Date(2009, 1, 3, 0, 0, 0, 0, time.UTC)
+	pizza := time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)
+	halving := time.Date(2012, 11, 28, 0, 0, 0, 0, time.UTC)
+	events := map[string][]Event{
+		"en": {
+			{Title: "Genesis block", Date: genesis, TranslationGroup: "genesis"},
+			{Title: "Bitcoin Pizza Day", Date: pizza, TranslationGroup: "pizza"},
+			{Title: "Hal Finney receives bitcoin", Date: time.Date(2009, 1, 12, 0, 0, 0, 0, time.UTC)},
+		},
+		"ru": {
+			{Title: "День пиццы", Date: pizza, TranslationGroup: "pizza"},
+			{Title: "Генезис-блок", Date: genesis, TranslationGroup: "genesis"},
+			{Title: "Первый халвинг", Date: halving, TranslationGroup: "halving"},
+		},
+		"es": {
+			{Title: "Bloque génesis", Date: genesis, TranslationGroup: "genesis"},
+		},
+	}
+	api := newTestAPI(t)
+	for lang, langEvents := range events {
+		db := languageDBs[lang]
+		if db == nil {
+			db = api.addLanguage(lang)
+		}
+		for _, e := range langEvents {
+			if err := db.Create(&e).Error; err != nil {
+				t.Fatalf("failed to create %s event: %v", lang, err)
+			}
+		}
+	}
+	return api
+}
+
+func TestGetEventTranslations(t *testing.T) {
+	api := newTranslationTestAPI(t)
+	api.Get("/events/:id/translations", getEventTranslationsHandler)
+
+	type translations struct {
+		TranslationGroup string           `json:"translation_group"`
+		Data             map[string]Event `json:"data"`
+		MissingLanguages []string         `json:"missing_languages"`
+	}
+	get := func(path string) (int, translations) {
+		var body translations
+		return api.do(http.MethodGet, path, "", &body), body
+	}
+
+	// 1. Variants are found through the translation group, not the ID
+	status, body := get("/api/events/1/translations?lang=ru")
+	if status != http.StatusOK || body.TranslationGroup != "pizza" {
+		t.Fatalf("expected 200 for the pizza day, got %d %+v", status, body)
+	}
+	if body.Data["ru"].Title != "День пиццы" || body.Data["en"].ID != 2 || len(body.Data) != 2 {
+		t.Fatalf("expected the ru and en variants, got %+v", body.Data)
+	}
+	if !reflect.DeepEqual(body.MissingLanguages, []string{"es"}) {
+		t.Fatalf("expected es to be missing, got %v", body.MissingLanguages)
+	}
+
+	// 2. An unlinked event has no other variant
+	status, body = get("/api/events/3/translations?lang=en")
+	if status != http.StatusOK || len(body.Data) != 1 || !reflect.DeepEqual(body.MissingLanguages, []string{"es", "ru"}) {
+		t.Fatalf("expected only the en event, got %d %+v", status, body)
+	}
+
+	// 3. Unknown events
+	if status, _ := get("/api/events/99/translations"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 Not Found, got %d", status)
+	}
+}
+
+func TestGetTranslationCoverage(t *testing.T) {
+	api := newTranslationTestAPI(t)
+	api.Get("/translations/coverage", getTranslationCoverageHandler)
+
+	var body struct {
+		Languages   []string           `json:"languages"`
+		TotalGroups int                `json:"total_groups"`
+		Data        []LanguageCoverage `json:"data"`
+	}
+	status := api.do(http.MethodGet, "/api/translations/coverage", "", &body)
+	if status != http.StatusOK || body.TotalGroups != 3 || !reflect.DeepEqual(body.Languages, []string{"en", "es", "ru"}) {
+		t.Fatalf("expected 3 groups in en, es and ru, got %d %+v", status, body)
+	}
+
+	type summary struct {
+		translated, missing int
+		unlinked            int64
+		groups              []string
+	}
+	want := map[string]summary{
+		"en": {2, 1, 1, []string{"halving"}},
+		"es": {1, 2, 0, []string{"pizza", "halving"}}, // By date
+		"ru": {3, 0, 0, []string{}},
+	}
+	for _, coverage := range body.Data {
+		groups := []string{}
+		for _, m := range coverage.Missing {
+			groups = append(groups, m.TranslationGroup)
+		}
+		got := summary{coverage.Translated, coverage.MissingCount, coverage.Unlinked, groups}
+		if !reflect.DeepEqual(got, want[coverage.Lang]) {
+			t.Errorf("%s: expected %+v, got %+v", coverage.Lang, want[coverage.Lang], got)
+		}
+	}
+
+	// Missing events are described by their default language variant when there is one
+	pizza := body.Data[1].Missing[0]
+	if pizza.Title != "Bitcoin Pizza Day" || !reflect.DeepEqual(pizza.AvailableIn, map[string]uint{"en": 2, "ru": 1}) {
+		t.Errorf("expected the en title and both IDs, got %+v", pizza)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// TrashedEvent is an event in the trash, with the time it was deleted
+type TrashedEvent struct {
+	Event
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// trashedEvents restricts a query to the events in the trash
+func trashedEvents(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Model(&Event{}).Where("deleted_at IS NOT NULL")
+}
+
+// findTrashedEvent loads the trashed event named by the :id route parameter.
+// When it returns nil, the error response has been written and err is the
+// result of writing it.
+func findTrashedEvent(c *fiber.Ctx, db *gorm.DB, handler, lang string) (*Event, error) {
+	eventID, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return nil, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid Event ID"})
+	}
+	var event Event
+	if err := trashedEvents(db).First(&event, uint(eventID)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Event not found in the trash"})
+		}
+		zlog.Error().Uint64("id", eventID).Str("lang", lang).Err(err).Msg(handler + ": Failed to retrieve event")
+		return nil, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Database error"})
+	}
+	return &event, nil
+}
+
+// purgeEvents permanently deletes trashed events along with their revisions.
+// The delete triggers remove them from events_fts and event_tags.
+func purgeEvents(tx *gorm.DB, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+	if err := tx.Where("event_id IN ?", ids).Delete(&EventRevision{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&Event{}, ids).Error
+}
+
+// Handler for GET /api/admin/trash
+// Lists the trashed events of the request language, most recently deleted first.
+func getTrashHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	page, limit, offset := parsePagination(c)
+	zlog.Info().Str("lang", lang).Int("page", page).Int("limit", limit).Msg("getTrashHandler called")
+
+	var total int64
+	if err := trashedEvents(db).Count(&total).Error; err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("getTrashHandler: Failed to count trashed events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve trash"})
+	}
+	var events []Event
+	if err := trashedEvents(db).Order("deleted_at desc, id desc").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("getTrashHandler: Failed to retrieve trashed events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to retrieve trash"})
+	}
+
+	trashed := make([]TrashedEvent, 0, len(events))
+	for _, event := range events {
+		trashed = append(trashed, TrashedEvent{Event: event, DeletedAt: event.DeletedAt.Time})
+	}
+	return c.JSON(fiber.Map{
+		"data":       trashed,
+		"pagination": newPaginationData(page, limit, total),
+	})
+}
+
+// Handler for POST /api/admin/trash/{id}/restore
+// Takes an event out of the trash and records it as a new revision.
+func restoreTrashedEventHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	event, err := findTrashedEvent(c, db, "restoreTrashedEventHandler", lang)
+	if event == nil {
+		return err
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(event).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		event.DeletedAt = gorm.DeletedAt{}
+		return recordRevision(tx, c, event, auditUndelete)
+	}); err != nil {
+		zlog.Error().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("restoreTrashedEventHandler: Failed to restore event")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to restore event"})
+	}
+	writeAudit(newAuditEntry(c, auditUndelete, lang, nil, event))
+
+	zlog.Info().Uint("id", event.ID).Str("lang", lang).Msg("restoreTrashedEventHandler: Event restored")
+	return c.JSON(fiber.Map{"data": event})
+}
+
+// Handler for DELETE /api/admin/trash/{id}
+// Permanently deletes a trashed event and its revisions.
+func purgeTrashedEventHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	event, err := findTrashedEvent(c, db, "purgeTrashedEventHandler", lang)
+	if event == nil {
+		return err
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return purgeEvents(tx, []Event{*event})
+	}); err != nil {
+		zlog.Error().Uint("id", event.ID).Str("lang", lang).Err(err).Msg("purgeTrashedEventHandler: Failed to purge event")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to purge event"})
+	}
+	writeAudit(newAuditEntry(c, auditPurge, lang, event, nil))
+
+	zlog.Info().Uint("id", event.ID).Str("lang", lang).Msg("purgeTrashedEventHandler: Event purged")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Handler for DELETE /api/admin/trash
+// Empties the trash, or only the events deleted before ?before= (RFC 3339 or YYYY-MM-DD).
+func emptyTrashHandler(c *fiber.Ctx) error {
+	lang, db := requestLanguage(c)
+	var before *time.Time
+	if v := c.Query("before"); v != "" {
+		t, err := parseAuditTime(v)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid before, expected an RFC 3339 timestamp or YYYY-MM-DD"})
+		}
+		before = &t
+	}
+
+	var events []Event
+	err := db.Transaction(func(tx *gorm.DB) error {
+		query := trashedEvents(tx)
+		if before != nil {
+			// deleted_at is stored in UTC (see nowUTC) and compared as text
+			query = query.Where("deleted_at < ?", before.UTC())
+		}
+		if err := query.Find(&events).Error; err != nil {
+			return err
+		}
+		return purgeEvents(tx, events)
+	})
+	if err != nil {
+		zlog.Error().Str("lang", lang).Err(err).Msg("emptyTrashHandler: Failed to purge events")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "Failed to empty trash"})
+	}
+
+	entries := make([]AuditEntry, 0, len(events))
+	for i := range events {
+		entries = append(entries, newAuditEntry(c, auditPurge, lang, &events[i], nil))
+	}
+	writeAudit(entries...)
+
+	zlog.Info().Int("purged", len(events)).Str("lang", lang).Msg("emptyTrashHandler: Trash emptied")
+	return c.JSON(fiber.Map{"purged": len(events)})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	// Deletion times are stored in UTC whatever the server's time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC+14", 14*60*60)
+	defer func() { time.Local = local }()
+
+	api := newTestAPI(t)
+	db := api.db
+	if err := initTagTables(db); err != nil {
+		t.Fatalf("initTagTables failed: %v", err)
+	}
+
+	api.Get("/events/:id", getEventHandler)
+	api.Get("/tags", getTagsHandler)
+	api.Patch("/events/:id", patchEventHandler)
+	api.Delete("/events/:id", deleteEventHandler)
+	api.Get("/admin/trash", getTrashHandler)
+	api.Post("/admin/trash/:id/restore", restoreTrashedEventHandler)
+	api.Delete("/admin/trash/:id", purgeTrashedEventHandler)
+	api.Delete("/admin/trash", emptyTrashHandler)
+
+	tagCount := func(tag string) int {
+		var tags struct {
+			Data []TagInfo `json:"data"`
+		}
+		api.do(http.MethodGet, "/api/tags", "", &tags)
+		for _, info := range tags.Data {
+			if info.Tag == tag {
+				return info.Count
+			}
+		}
+		return 0
+	}
+
+	date := time.Date(2010, 5, 22, 0, 0, 0, 0, time.UTC)
+	events := []Event{
+		{Title: "Pizza day", Date: date, Tags: StringList{"adoption"}},
+		{Title: "Pizza day (copy)", Date: date, Tags: StringList{"adoption"}},
+		{Title: "Pizza day (typo)", Date: date, Tags: StringList{"adoption"}},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatalf("failed to create events: %v", err)
+	}
+
+	// 1. Deleting moves events to the trash, where reads no longer see them
+	for _, id := range []string{"2", "3"} {
+		if status := api.do(http.MethodDelete, "/api/events/"+id, "", nil); status != http.StatusNoContent {
+			t.Fatalf("expected 204 No Content, got %d", status)
+		}
+	}
+	if status := api.do(http.MethodGet, "/api/events/2", "", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for a trashed event, got %d", status)
+	}
+	if status := api.do(http.MethodPatch, "/api/events/2", `{"title": "Edited"}`, nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 when updating a trashed event, got %d", status)
+	}
+	if got := tagCount("adoption"); got != 1 {
+		t.Fatalf("expected trashed events to be left out of tag counts, got %d", got)
+	}
+	var trash struct {
+		Data []TrashedEvent `json:"data"`
+	}
+	api.do(http.MethodGet, "/api/admin/trash", "", &trash)
+	if len(trash.Data) != 2 || trash.Data[0].ID != 3 || trash.Data[0].DeletedAt.IsZero() {
+		t.Fatalf("expected events 3 and 2 in the trash, got %+v", trash.Data)
+	}
+	var deletedAt string
+	db.Raw("SELECT CAST(deleted_at AS TEXT) FROM events WHERE id = 2").Scan(&deletedAt)
+	if !strings.HasSuffix(deletedAt, "+00:00") {
+		t.Fatalf("expected deleted_at in UTC, got %q", deletedAt)
+	}
+
+	// 2. Restoring takes an event out of the trash
+	if status := api.do(http.MethodPost, "/api/admin/trash/2/restore", "", nil); status != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %d", status)
+	}
+	if status := api.do(http.MethodGet, "/api/events/2", "", nil); status != http.StatusOK {
+		t.Fatalf("expected the restored event to be readable, got %d", status)
+	}
+	if got := tagCount("adoption"); got != 2 {
+		t.Fatalf("expected the restored event in tag counts, got %d", got)
+	}
+	var revision EventRevision
+	db.Where("event_id = ?", 2).Order("revision desc").First(&revision)
+	if revision.Action != auditUndelete || revision.Snapshot.Title != "Pizza day (copy)" {
+		t.Fatalf("expected an undelete revision, got %+v", revision)
+	}
+	if status := api.do(http.MethodPost, "/api/admin/trash/2/restore", "", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an event not in the trash, got %d", status)
+	}
+
+	// 3. Only trashed events can be purged; purging removes the row for good
+	if status := api.do(http.MethodDelete, "/api/admin/trash/1", "", nil); status != http.StatusNotFound {
+		t.Fatalf("expected 404 when purging an event not in the trash, got %d", status)
+	}
+	if status := api.do(http.MethodDelete, "/api/admin/trash/3", "", nil); status != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %d", status)
+	}
+	var count int64
+	db.Unscoped().Model(&Event{}).Where("id = ?", 3).Count(&count)
+	if count != 0 {
+		t.Fatalf("expected event 3 to be purged")
+	}
+
+	// 4. Emptying the trash purges what is left, optionally only older deletions
+	api.do(http.MethodDelete, "/api/events/2", "", nil)
+	var emptied struct {
+		Purged int `json:"purged"`
+	}
+	if api.do(http.MethodDelete, "/api/admin/trash?before=2000-01-01", "", &emptied); emptied.Purged != 0 {
+		t.Fatalf("expected nothing deleted before 2000 to be purged, got %d", emptied.Purged)
+	}
+	if api.do(http.MethodDelete, "/api/admin/trash?before="+time.Now().UTC().Add(-time.Hour).Format(time.RFC3339), "", &emptied); emptied.Purged != 0 {
+		t.Fatalf("expected nothing deleted before an hour ago to be purged, got %d", emptied.Purged)
+	}
+	if api.do(http.MethodDelete, "/api/admin/trash", "", &emptied); emptied.Purged != 1 {
+		t.Fatalf("expected 1 event purged, got %d", emptied.Purged)
+	}
+	db.Unscoped().Model(&Event{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("expected 1 event left, got %d", count)
+	}
+}
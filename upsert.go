@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// eventConflictError is a write refused because another stored event already
+// has the external ID it sets
+type eventConflictError struct {
+	message string
+	EventID uint // The event holding the external ID
+}
+
+func (e *eventConflictError) Error() string { return e.message }
+
+// response is the 409 body for the conflict
+func (e *eventConflictError) response() fiber.Map {
+	return fiber.Map{"error": e.message, "conflict_id": e.EventID}
+}
+
+// eventByExternalID loads the event with the external ID, trashed events
+// included, or returns nil when there is none
+func eventByExternalID(tx *gorm.DB, externalID string) (*Event, error) {
+	var event Event
+	if err := tx.Unscoped().Where("external_id = ?", externalID).First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &event, nil
+}
+
+// checkExternalIDFree returns an eventConflictError when an event other than
+// eventID already has the external ID. A nil external ID is always free.
+func checkExternalIDFree(tx *gorm.DB, externalID *string, eventID uint) error {
+	if externalID == nil {
+		return nil
+	}
+	holder, err := eventByExternalID(tx, *externalID)
+	if err != nil || holder == nil || holder.ID == eventID {
+		return err
+	}
+	return externalIDConflict(holder)
+}
+
+// externalIDConflict describes why the external ID of holder cannot be reused
+func externalIDConflict(holder *Event) error {
+	if holder.DeletedAt.Valid {
+		return &eventConflictError{
+			message: fmt.Sprintf("Event %d with external_id '%s' is in the trash, restore or purge it first", holder.ID, *holder.ExternalID),
+			EventID: holder.ID,
+		}
+	}
+	return &eventConflictError{
+		message: fmt.Sprintf("Event %d already has external_id '%s'", holder.ID, *holder.ExternalID),
+		EventID: holder.ID,
+	}
+}
+
+// saveEvent creates the event. With upsert, an event that has an external ID
+// already stored replaces that event instead, like a PUT; trashed events are
+// never replaced. It returns the replaced event as it was before the write, or
+// nil when a new event was created. It must run in a transaction.
+func saveEvent(tx *gorm.DB, c *fiber.Ctx, event *Event, upsert bool) (*Event, error) {
+	if event.ExternalID != nil {
+		existing, err := eventByExternalID(tx, *event.ExternalID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			if !upsert || existing.DeletedAt.Valid {
+				return nil, externalIDConflict(existing)
+			}
+			before := *existing
+			if err := applyEventUpdate(tx, c, existing, eventUpdateData(event), auditUpdate); err != nil {
+				return nil, err
+			}
+			*event = *existing
+			return &before, nil
+		}
+	}
+	return nil, insertEvent(tx, c, event)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestUpsertByExternalID(t *testing.T) {
+	api := newTestAPI(t)
+	db := api.db
+	api.Post("/events", createEventHandler)
+	api.Post("/events/batch", batchCreateEventsHandler)
+	api.Patch("/events/:id", patchEventHandler)
+	api.Delete("/events/:id", deleteEventHandler)
+
+	type single struct {
+		Data       Event  `json:"data"`
+		Error      string `json:"error"`
+		ConflictID uint   `json:"conflict_id"`
+	}
+	genesis := `{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "external_id": "genesis-block", "tags": ["mining"]}`
+
+	// 1. The first write creates the event, an upsert of the same key replaces it
+	var got single
+	if status := api.do(http.MethodPost, "/api/events?upsert=true", genesis, &got); status != http.StatusCreated || got.Data.ExternalID == nil || *got.Data.ExternalID != "genesis-block" {
+		t.Fatalf("expected 201 with the external_id, got %d %+v", status, got)
+	}
+	if status := api.do(http.MethodPost, "/api/events?upsert=true", `{"title": "Genesis block", "date": "2009-01-03T00:00:00Z", "external_id": "genesis-block"}`, &got); status != http.StatusOK || got.Data.ID != 1 || got.Data.Title != "Genesis block" || len(got.Data.Tags) != 0 {
+		t.Fatalf("expected 200 with event 1 replaced, got %d %+v", status, got)
+	}
+	var revisions int64
+	db.Model(&EventRevision{}).Where("event_id = ?", 1).Count(&revisions)
+	if revisions != 2 {
+		t.Fatalf("expected the upsert to record a revision, got %d revisions", revisions)
+	}
+
+	// 2. Without upsert, or from another event, the key is a conflict
+	got = single{}
+	if status := api.do(http.MethodPost, "/api/events", genesis, &got); status != http.StatusConflict || got.ConflictID != 1 {
+		t.Fatalf("expected 409 naming event 1, got %d %+v", status, got)
+	}
+	api.do(http.MethodPost, "/api/events", `{"title": "Pizza day", "date": "2010-05-22T00:00:00Z"}`, nil)
+	if status := api.do(http.MethodPatch, "/api/events/2", `{"external_id": "genesis-block"}`, nil); status != http.StatusConflict {
+		t.Fatalf("expected 409 when patching in a used key, got %d", status)
+	}
+	if status := api.do(http.MethodPatch, "/api/events/2", `{"external_id": " "}`, nil); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty key, got %d", status)
+	}
+
+	// 3. Batches upsert per item; keys of trashed events are not reused
+	api.do(http.MethodPatch, "/api/events/2", `{"external_id": "pizza-day"}`, nil)
+	api.do(http.MethodDelete, "/api/events/2", "", nil)
+	var report struct {
+		Data []BatchItemResult `json:"data"`
+	}
+	status := api.do(http.MethodPost, "/api/events/batch?upsert=true", `[
+		{"title": "Genesis", "date": "2009-01-03T00:00:00Z", "external_id": "genesis-block"},
+		{"title": "Pizza day", "date": "2010-05-22T00:00:00Z", "external_id": "pizza-day"},
+		{"title": "Mt. Gox", "date": "2014-02-24T00:00:00Z", "external_id": "mt-gox"}
+	]`, &report)
+	if status != http.StatusMultiStatus {
+		t.Fatalf("expected 207 Multi-Status, got %d", status)
+	}
+	want := []BatchItemResult{
+		{Index: 0, Status: batchUpdated, ID: 1},
+		{Index: 1, Status: batchConflict, Error: "Event 2 with external_id 'pizza-day' is in the trash, restore or purge it first"},
+		{Index: 2, Status: batchCreated, ID: 3},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(report.Data[i], want[i]) {
+			t.Errorf("item %d: expected %+v, got %+v", i, want[i], report.Data[i])
+		}
+	}
+
+	// 4. In atomic mode a conflict rolls back the whole batch
+	status = api.do(http.MethodPost, "/api/events/batch?atomic=true", `[
+		{"title": "Halving", "date": "2012-11-28T00:00:00Z", "external_id": "halving-1"},
+		{"title": "Mt. Gox", "date": "2014-02-24T00:00:00Z", "external_id": "mt-gox"}
+	]`, &report)
+	if status != http.StatusUnprocessableEntity || report.Data[0].Status != batchAborted || report.Data[1].Status != batchConflict {
+		t.Fatalf("expected the batch to be aborted on the conflict, got %d %+v", status, report.Data)
+	}
+	var count int64
+	db.Model(&Event{}).Where("external_id = ?", "halving-1").Count(&count)
+	if count != 0 {
+		t.Fatalf("expected the aborted item not to be stored")
+	}
+}